@@ -11,13 +11,11 @@ import (
 	"github.com/labstack/echo/v4"
 	"github.com/montanaflynn/stats"
 	uuid "github.com/satori/go.uuid"
-	"gorm.io/gorm/clause"
 )
 
 func agentIdle() error {
-	var games []Game
-	thirtySecondsAgo := time.Now().Add(time.Second * -30)
-	if err := db.Where("updated_at < ?", thirtySecondsAgo).Not(Game{ActiveAgentType: "user"}).Not(db.Where(Game{InactiveAgent: placeHolder}).Or(Game{End: true})).Find(&games).Error; err != nil {
+	games, err := store.idleAgentGames(time.Now().Add(-settings.IdleTimeout))
+	if err != nil {
 		return err
 	}
 	for _, game := range games {
@@ -25,20 +23,20 @@ func agentIdle() error {
 			return err
 		}
 	}
-	var count int64
-	if err := db.Model(&Game{}).Not(db.Where(Game{ActiveAgentType: "user"}).Or(Game{InactiveAgentType: "user"})).Not(db.Where(Game{InactiveAgent: placeHolder}).Or(Game{End: true})).Count(&count).Error; err != nil {
+	count, err := store.countAgentGames()
+	if err != nil {
 		return err
 	}
-	if count < 5 {
-		if err := db.Where(Game{InactiveAgent: placeHolder}).Find(&games).Error; err != nil {
+	if count < int64(settings.AgentGames) {
+		if games, err = store.openGames(); err != nil {
 			return err
 		}
-		newGames := 3
+		newGames := settings.NewAgents
 		if newGames >= len(games) {
 			newGames = len(games)
 		}
 		for i := 0; i < newGames; i++ {
-			if _, err := games[i].makeAgent("agent"); err != nil {
+			if _, err := games[i].makeAgent("agent", "", 0, 0, 0); err != nil {
 				return err
 			}
 		}
@@ -46,20 +44,29 @@ func agentIdle() error {
 	return nil
 }
 
-func (game *Game) makeAgent(agentType string) (uuid.UUID, error) {
+// agentTypes agent types a game seats: users moving by request and the
+// search agents playRound moves for.
+var agentTypes = []string{"user", "agent", "alphabeta", "mcts", "neural"}
+
+func validAgentType(agentType string) bool {
+	for _, t := range agentTypes {
+		if t == agentType {
+			return true
+		}
+	}
+	return false
+}
+
+func (game *Game) makeAgent(agentType, name string, depth, playouts, moveTime int) (uuid.UUID, error) {
 	id := uuid.NewV4()
-	if err := game.addAgent(id, agentType); err != nil {
+	if err := game.addAgent(id, agentType, name, depth, playouts, moveTime); err != nil {
 		return uuid.Nil, err
 	}
 	return id, nil
 }
 
 func getAgent(id uuid.UUID) (*Game, error) {
-	var game Game
-	if err := db.Preload(clause.Associations).Where(Game{ActiveAgent: id}).Or(Game{InactiveAgent: id}).First(&game).Error; err != nil {
-		return nil, err
-	}
-	return &game, nil
+	return store.getAgent(id)
 }
 
 func (game *Game) playRound(id uuid.UUID, state *chessState) error {
@@ -72,17 +79,46 @@ func (game *Game) playRound(id uuid.UUID, state *chessState) error {
 		}
 		return game.putBoard(*state)
 	}
-	if game.End {
+	if game.End != resultNone {
 		return nil
 	}
-	board, err := getBoard(game.BoardID)
+	moveTime := time.Duration(game.ActiveAgentMoveTime) * time.Millisecond
+	switch game.ActiveAgentType {
+	case "alphabeta":
+		m, _, err := game.Board.Board.alphabeta(game.ActiveAgentPurple, game.ActiveAgentDepth, moveTime)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusNotAcceptable, err.Error())
+		}
+		return game.putBoard(*game.moveToBoard(m))
+	case "neural":
+		m, _, err := game.Board.Board.neuralSearch(game.ActiveAgentPurple, game.ActiveAgentDepth, moveTime)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusNotAcceptable, err.Error())
+		}
+		return game.putBoard(*game.moveToBoard(m))
+	case "mcts":
+		choice, err := game.Board.mcts(game.ActiveAgentPurple, game.ActiveAgentPlayouts, moveTime)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusNotAcceptable, err.Error())
+		}
+		return game.putBoard(choice)
+	}
+	choice, err := agentChoice(game.BoardID)
 	if err != nil {
 		return err
 	}
+	return game.putBoard(choice)
+}
+
+func agentChoice(boardID uint) (chessState, error) {
+	board, err := getBoard(boardID)
+	if err != nil {
+		return chessState{}, err
+	}
 	if len(board.Children) == 0 {
-		return echo.NewHTTPError(http.StatusNotAcceptable, "no moves available")
+		return chessState{}, echo.NewHTTPError(http.StatusNotAcceptable, "no moves available")
 	}
-	return game.putBoard(decide(board.Children))
+	return decide(board.Children), nil
 }
 
 func decide(boards []Board) chessState {
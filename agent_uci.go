@@ -0,0 +1,288 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const uciDepthMax = 3
+
+// uciEngine uci engine.
+type uciEngine struct {
+	out           io.Writer
+	lock          sync.Mutex
+	search        sync.WaitGroup
+	stop          chan struct{}
+	infinite      bool
+	board         chessState
+	depth         int
+	deterministic bool
+}
+
+func (engine *uciEngine) send(format string, a ...interface{}) {
+	engine.lock.Lock()
+	defer engine.lock.Unlock()
+	fmt.Fprintf(engine.out, format+"\n", a...)
+}
+
+func (engine *uciEngine) halt() {
+	if engine.stop != nil {
+		close(engine.stop)
+		engine.stop = nil
+	}
+	engine.search.Wait()
+}
+
+func (engine *uciEngine) setOption(args []string) {
+	name, value := args, []string{}
+	for i, arg := range args {
+		if arg == "value" {
+			name, value = args[:i], args[i+1:]
+			break
+		}
+	}
+	if len(name) > 0 && name[0] == "name" {
+		name = name[1:]
+	}
+	switch strings.ToLower(strings.Join(name, " ")) {
+	case "depth":
+		depth, err := strconv.Atoi(strings.Join(value, " "))
+		if err != nil || depth < 1 || depth > uciDepthMax {
+			engine.send("info string invalid depth %q", strings.Join(value, " "))
+			return
+		}
+		engine.depth = depth
+	case "deterministic":
+		engine.deterministic = strings.Join(value, " ") == "true"
+	default:
+		engine.send("info string unknown option %q", strings.Join(name, " "))
+	}
+}
+
+func (engine *uciEngine) position(args []string) error {
+	if len(args) == 0 {
+		return errors.New("position requires startpos or fen")
+	}
+	fields := []string{}
+	switch args[0] {
+	case "startpos":
+		fields = append(fields, initialFEN)
+		args = args[1:]
+	case "fen":
+		args = args[1:]
+		for len(args) > 0 && args[0] != "moves" {
+			fields = append(fields, args[0])
+			args = args[1:]
+		}
+	default:
+		return fmt.Errorf("invalid position %q", args[0])
+	}
+	board, _, _, err := parseFEN(strings.Join(fields, " "))
+	if err != nil {
+		return err
+	}
+	if len(args) > 0 && args[0] != "moves" {
+		return fmt.Errorf("expected moves, got %q", args[0])
+	}
+	if len(args) > 0 {
+		for _, uci := range args[1:] {
+			isPurple := board.activePurple()
+			m, err := parseUCI(uci, board.moveList(isPurple), isPurple)
+			if err != nil {
+				return err
+			}
+			board = board.moveToBoard(m, isPurple).swap()
+		}
+	}
+	engine.board = board
+	return nil
+}
+
+// bestChild picks the child with the highest score for the side moving into
+// it, preferring the lowest score for the other side on ties.
+func bestChild(boards []Board) Board {
+	best := boards[0]
+	for _, board := range boards[1:] {
+		if board.InactiveScore > best.InactiveScore || (board.InactiveScore == best.InactiveScore && board.ActiveScore < best.ActiveScore) {
+			best = board
+		}
+	}
+	return best
+}
+
+// bestMove searches the state, answering from the children scored so far
+// once stop is closed.
+func (engine *uciEngine) bestMove(state chessState, depth int, deterministic bool, stop <-chan struct{}) (string, error) {
+	isPurple := state.activePurple()
+	moves := state.moveList(isPurple)
+	if len(moves) == 0 {
+		return "0000", nil
+	}
+	board, err := makeBoard(state)
+	if err != nil {
+		return "", err
+	}
+	if board, err = getBoard(board.ID); err != nil {
+		return "", err
+	}
+	if err := board.lookaheadDepth(isPurple, depth, stop); errors.Is(err, errStopped) {
+		if board, err = getBoard(board.ID); err != nil {
+			return "", err
+		}
+	} else if err != nil {
+		return "", err
+	}
+	choice := bestChild(board.Children)
+	if !deterministic {
+		next := decide(board.Children)
+		for _, child := range board.Children {
+			if child.Board == next {
+				choice = child
+			}
+		}
+	}
+	m, ok := state.findMove(moves, choice.Board, isPurple)
+	if !ok {
+		return "", errors.New("no move for chosen board")
+	}
+	score := fmt.Sprintf("cp %d", choice.InactiveScore-choice.ActiveScore)
+	if choice.ActiveCheckMate && choice.ActiveScore < 0 {
+		score = "mate 1"
+	}
+	engine.send("info depth %d score %s nodes %d pv %s", depth, score, len(board.Children), m.uci(isPurple))
+	engine.send("info string active %d inactive %d", choice.ActiveScore, choice.InactiveScore)
+	return m.uci(isPurple), nil
+}
+
+func (engine *uciEngine) goSearch(args []string) {
+	depth := 0
+	infinite := false
+	limits := map[string]int{}
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "infinite":
+			infinite = true
+		case "depth", "movetime", "wtime", "btime", "winc", "binc":
+			if i+1 < len(args) {
+				if n, err := strconv.Atoi(args[i+1]); err == nil && n >= 0 {
+					limits[args[i]] = n
+				}
+				i++
+			}
+		}
+	}
+	if d, ok := limits["depth"]; ok && d >= 1 {
+		depth = d
+	}
+	moveTime := engine.moveTime(limits)
+	if depth == 0 {
+		// A clock bounds the search, so search as deep as it allows.
+		depth = engine.depth
+		if moveTime > 0 {
+			depth = uciDepthMax
+		}
+	}
+	if depth > uciDepthMax {
+		depth = uciDepthMax
+	}
+	stop := make(chan struct{})
+	engine.stop, engine.infinite = stop, infinite
+	limit := stop
+	if moveTime > 0 && !infinite {
+		limit = make(chan struct{})
+		go func(limit chan struct{}) {
+			timer := time.NewTimer(moveTime)
+			defer timer.Stop()
+			select {
+			case <-stop:
+			case <-timer.C:
+			}
+			close(limit)
+		}(limit)
+	}
+	engine.search.Add(1)
+	go func(board chessState, deterministic bool) {
+		defer engine.search.Done()
+		best, err := engine.bestMove(board, depth, deterministic, limit)
+		if err != nil {
+			engine.send("info string %s", err)
+			best = "0000"
+		}
+		if infinite {
+			<-stop
+		}
+		engine.send("bestmove %s", best)
+	}(engine.board, engine.deterministic)
+}
+
+// moveTime time to spend on the move: movetime when given, else a thirtieth
+// of the clock of the side to move plus its increment, else no limit.
+func (engine *uciEngine) moveTime(limits map[string]int) time.Duration {
+	if ms, ok := limits["movetime"]; ok {
+		return time.Duration(ms) * time.Millisecond
+	}
+	clock, inc := "wtime", "winc"
+	if !engine.board.activePurple() {
+		clock, inc = "btime", "binc"
+	}
+	ms, ok := limits[clock]
+	if !ok {
+		return 0
+	}
+	return time.Duration(ms/30+limits[inc]) * time.Millisecond
+}
+
+func uciCommand(in io.Reader, out io.Writer) error {
+	engine := &uciEngine{out: out, board: initialBoard, depth: 1, deterministic: true}
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "uci":
+			engine.send("id name nknight")
+			engine.send("id author maplefeline")
+			engine.send("option name Depth type spin default 1 min 1 max %d", uciDepthMax)
+			engine.send("option name Deterministic type check default true")
+			engine.send("uciok")
+		case "isready":
+			engine.send("readyok")
+		case "ucinewgame":
+			engine.halt()
+			engine.board = initialBoard
+		case "setoption":
+			engine.halt()
+			engine.setOption(fields[1:])
+		case "position":
+			engine.halt()
+			if err := engine.position(fields[1:]); err != nil {
+				engine.send("info string %s", err)
+			}
+		case "go":
+			engine.halt()
+			engine.goSearch(fields[1:])
+		case "stop":
+			engine.halt()
+		case "quit":
+			engine.halt()
+			return nil
+		case "debug", "ponderhit":
+		default:
+			engine.send("info string unknown command %q", fields[0])
+		}
+	}
+	// Without more input let a bounded search answer before stopping.
+	if !engine.infinite {
+		engine.search.Wait()
+	}
+	engine.halt()
+	return scanner.Err()
+}
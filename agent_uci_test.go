@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+func uciSession(c *C, input ...string) []string {
+	var out bytes.Buffer
+	c.Assert(uciCommand(strings.NewReader(strings.Join(input, "\n")), &out), IsNil)
+	return strings.Split(strings.TrimSpace(out.String()), "\n")
+}
+
+func (s *NKnightSuite) TestUCIHandshake(c *C) {
+	lines := uciSession(c, "uci", "isready", "quit")
+	c.Assert(lines[0], Equals, "id name nknight")
+	c.Assert(lines[len(lines)-2:], DeepEquals, []string{"uciok", "readyok"})
+	lines = uciSession(c, "bogus", "setoption name Depth value 9", "setoption name Colour value red", "position fen 8/8 w - - 0 1")
+	c.Assert(lines, DeepEquals, []string{
+		`info string unknown command "bogus"`,
+		`info string invalid depth "9"`,
+		`info string unknown option "Colour"`,
+		"info string fen is not 8 ranks: 2",
+	})
+	lines = uciSession(c, "position startpos e2e4", "position startpos moves e2e5")
+	c.Assert(lines, DeepEquals, []string{
+		`info string expected moves, got "e2e4"`,
+		`info string illegal uci "e2e5"`,
+	})
+}
+
+func (s *NKnightSuite) TestUCIGo(c *C) {
+	lines := uciSession(c, "position startpos moves e2e4 e7e5", "go depth 1")
+	c.Assert(lines, HasLen, 3)
+	c.Assert(lines[0], Matches, `info depth 1 score cp -?\d+ nodes 29 pv [a-h][1-8][a-h][1-8]`)
+	c.Assert(lines[1], Matches, `info string active -?\d+ inactive -?\d+`)
+	c.Assert(lines[2], Equals, "bestmove "+strings.Fields(lines[0])[9])
+
+	lines = uciSession(c, "position fen 6k1/5ppp/8/8/8/8/5PPP/R5K1 w - - 0 1", "go depth 2")
+	c.Assert(lines[0], Equals, "info depth 2 score mate 1 nodes 20 pv a1a8")
+	c.Assert(lines[2], Equals, "bestmove a1a8")
+
+	lines = uciSession(c, "position fen 6k1/5ppp/8/8/8/8/5PPP/R5K1 w - - 0 1 moves a1a8", "go infinite", "stop")
+	c.Assert(lines, DeepEquals, []string{"bestmove 0000"})
+
+	lines = uciSession(c, "setoption name Deterministic value false", "position startpos", "go")
+	c.Assert(lines[2], Matches, "bestmove [a-h][1-8][a-h][1-8]")
+}
+
+func (s *NKnightSuite) TestUCIStop(c *C) {
+	state, _, _, err := parseFEN("2r1k3/1p3p2/8/8/8/8/1PP2PP1/R3K2R w KQ - 0 1")
+	c.Assert(err, IsNil)
+	stop := make(chan struct{})
+	close(stop)
+	var out bytes.Buffer
+	engine := &uciEngine{out: &out}
+	best, err := engine.bestMove(state, 3, true, stop)
+	c.Assert(err, IsNil)
+	c.Assert(best, Matches, "[a-h][1-8][a-h][1-8]")
+	board, err := getBoardByBoard(state)
+	c.Assert(err, IsNil)
+	c.Assert(len(board.Children), Equals, len(state.moveList(true)))
+	for _, child := range board.Children {
+		child, err := getBoard(child.ID)
+		c.Assert(err, IsNil)
+		c.Assert(len(child.Children), Equals, 0)
+	}
+	c.Assert(board.lookaheadDepth(true, 2, stop), Equals, errStopped)
+
+	lines := uciSession(c, "position fen r1bqk2r/pppp1ppp/2n2n2/2b1p3/2B1P3/5N2/PPPP1PPP/RNBQK2R w KQkq - 6 5", "go depth 3", "quit")
+	c.Assert(lines[len(lines)-1], Matches, "bestmove [a-h][1-8][a-h][1-8]")
+
+	start := time.Now()
+	lines = uciSession(c, "position fen r2qk2r/ppp2ppp/2np1n2/2b1p1B1/2B1P1b1/2NP1N2/PPP2PPP/R2QK2R w KQkq - 0 7", "go movetime 100")
+	c.Assert(time.Since(start) < 5*time.Second, Equals, true)
+	c.Assert(lines[0], Matches, "info depth 3 .*")
+	c.Assert(lines[len(lines)-1], Matches, "bestmove [a-h][1-8][a-h][1-8]")
+}
+
+func (s *NKnightSuite) TestUCIMoveTime(c *C) {
+	engine := &uciEngine{board: initialBoard}
+	c.Assert(engine.moveTime(map[string]int{"movetime": 250, "wtime": 60000}), Equals, 250*time.Millisecond)
+	c.Assert(engine.moveTime(map[string]int{"wtime": 60000, "btime": 3000, "winc": 1000}), Equals, 3*time.Second)
+	engine.board = engine.board.swap()
+	c.Assert(engine.moveTime(map[string]int{"wtime": 60000, "btime": 3000, "binc": 100}), Equals, 200*time.Millisecond)
+	c.Assert(engine.moveTime(map[string]int{"depth": 2}), Equals, time.Duration(0))
+}
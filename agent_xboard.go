@@ -0,0 +1,307 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// xboardEngine xboard engine.
+type xboardEngine struct {
+	out          io.Writer
+	board        chessState
+	history      []chessState
+	halfmoves    []int
+	force        bool
+	over         bool
+	post         bool
+	enginePurple bool
+	depth        int
+	movesPerTime int
+	increment    time.Duration
+	perMove      time.Duration
+	clock        time.Duration
+}
+
+func (engine *xboardEngine) send(format string, a ...interface{}) {
+	fmt.Fprintf(engine.out, format+"\n", a...)
+}
+
+func (engine *xboardEngine) reset(board chessState, halfmove int) {
+	engine.board = board
+	engine.history = []chessState{board}
+	engine.halfmoves = []int{halfmove}
+	engine.over = false
+}
+
+func (engine *xboardEngine) halfmove() int {
+	return engine.halfmoves[len(engine.halfmoves)-1]
+}
+
+func (engine *xboardEngine) repetitions() int {
+	count := 0
+	start := len(engine.history) - 1 - engine.halfmove()
+	if start < 0 {
+		start = 0
+	}
+	for _, board := range engine.history[start:] {
+		if board == engine.board {
+			count = count + 1
+		}
+	}
+	return count
+}
+
+func (engine *xboardEngine) outcome() (gameResult, string) {
+	if result, termination := engine.board.outcome(); result != resultNone {
+		return result, termination
+	}
+	if engine.repetitions() >= 3 {
+		return resultDraw, "threefold repetition"
+	}
+	if engine.halfmove() >= 100 {
+		return resultDraw, "fifty-move rule"
+	}
+	return resultNone, ""
+}
+
+func (engine *xboardEngine) play(m move) {
+	isPurple := engine.board.activePurple()
+	next := engine.board.moveToBoard(m, isPurple).swap()
+	halfmove := engine.halfmove() + 1
+	if engine.board.resetsClock(next) {
+		halfmove = 0
+	}
+	engine.board = next
+	engine.history = append(engine.history, next)
+	engine.halfmoves = append(engine.halfmoves, halfmove)
+	if result, termination := engine.outcome(); result != resultNone {
+		engine.over = true
+		engine.send("%s {%s}", result, termination)
+	}
+}
+
+func (engine *xboardEngine) undo(plies int) {
+	if plies >= len(engine.history) {
+		plies = len(engine.history) - 1
+	}
+	engine.history = engine.history[:len(engine.history)-plies]
+	engine.halfmoves = engine.halfmoves[:len(engine.halfmoves)-plies]
+	engine.board = engine.history[len(engine.history)-1]
+	engine.over = false
+}
+
+// searchDepth lowers the lookahead depth when the clock is short.
+func (engine *xboardEngine) searchDepth() int {
+	budget := engine.perMove
+	if budget == 0 && engine.clock > 0 {
+		movesToGo := 30
+		if engine.movesPerTime > 0 {
+			movesToGo = engine.movesPerTime - (len(engine.history)/2)%engine.movesPerTime
+		}
+		budget = engine.clock/time.Duration(movesToGo) + engine.increment
+	}
+	depth := engine.depth
+	if budget > 0 && budget < time.Second {
+		depth = 1
+	} else if budget > 0 && budget < 5*time.Second && depth > 2 {
+		depth = 2
+	}
+	return depth
+}
+
+func (engine *xboardEngine) think() error {
+	start := time.Now()
+	isPurple := engine.board.activePurple()
+	moves := engine.board.moveList(isPurple)
+	if len(moves) == 0 {
+		return nil
+	}
+	depth := engine.searchDepth()
+	board, err := makeBoard(engine.board)
+	if err != nil {
+		return err
+	}
+	if board, err = getBoard(board.ID); err != nil {
+		return err
+	}
+	if err := board.lookaheadDepth(isPurple, depth, nil); err != nil {
+		return err
+	}
+	choice, err := agentChoice(board.ID)
+	if err != nil {
+		return err
+	}
+	m, ok := engine.board.findMove(moves, choice, isPurple)
+	if !ok {
+		return errors.New("no move for chosen board")
+	}
+	if engine.post {
+		for _, child := range board.Children {
+			if child.Board == choice {
+				engine.send("%d %d %d %d %s", depth, child.InactiveScore-child.ActiveScore, time.Since(start).Milliseconds()/10, len(board.Children), m.uci(isPurple))
+			}
+		}
+	}
+	engine.send("move %s", m.uci(isPurple))
+	engine.play(m)
+	return nil
+}
+
+func (engine *xboardEngine) engineTurn() bool {
+	return !engine.force && !engine.over && engine.board.activePurple() == engine.enginePurple
+}
+
+func parseClock(s string) (time.Duration, error) {
+	parts := strings.SplitN(s, ":", 2)
+	minutes, err := strconv.ParseFloat(parts[0], 64)
+	if err != nil {
+		return 0, err
+	}
+	seconds := 0.0
+	if len(parts) == 2 {
+		if seconds, err = strconv.ParseFloat(parts[1], 64); err != nil {
+			return 0, err
+		}
+	}
+	return time.Duration((minutes*60 + seconds) * float64(time.Second)), nil
+}
+
+func (engine *xboardEngine) level(args []string) error {
+	if len(args) != 3 {
+		return errors.New("level takes 3 arguments")
+	}
+	movesPerTime, err := strconv.Atoi(args[0])
+	if err != nil {
+		return err
+	}
+	base, err := parseClock(args[1])
+	if err != nil {
+		return err
+	}
+	increment, err := strconv.ParseFloat(args[2], 64)
+	if err != nil {
+		return err
+	}
+	engine.movesPerTime, engine.clock, engine.perMove = movesPerTime, base, 0
+	engine.increment = time.Duration(increment * float64(time.Second))
+	return nil
+}
+
+func (engine *xboardEngine) command(fields []string) (bool, error) {
+	args := fields[1:]
+	switch fields[0] {
+	case "xboard", "accepted", "rejected", "random", "hard", "easy", "computer", "name", "rating", "draw", "otim", "?", "ics":
+	case "protover":
+		engine.send(`feature myname="nknight" setboard=1 usermove=1 ping=1 playother=1 san=0 colors=0 sigint=0 sigterm=0 reuse=1 analyze=0 done=1`)
+	case "new":
+		engine.reset(initialBoard, 0)
+		engine.force, engine.enginePurple, engine.depth = false, false, 1
+	case "force":
+		engine.force = true
+	case "go":
+		engine.force, engine.enginePurple = false, engine.board.activePurple()
+		if engine.engineTurn() {
+			return false, engine.think()
+		}
+	case "playother":
+		engine.force, engine.enginePurple = false, !engine.board.activePurple()
+	case "white", "black":
+		engine.enginePurple = fields[0] == "black"
+	case "setboard":
+		board, halfmove, _, err := parseFEN(strings.Join(args, " "))
+		if err != nil {
+			engine.send("tellusererror Illegal position: %s", err)
+			return false, nil
+		}
+		engine.reset(board, halfmove)
+	case "usermove":
+		if len(args) != 1 {
+			engine.send("Error (usermove takes 1 argument): %s", strings.Join(fields, " "))
+			return false, nil
+		}
+		if engine.over {
+			engine.send("Illegal move (game is over): %s", args[0])
+			return false, nil
+		}
+		isPurple := engine.board.activePurple()
+		m, err := parseUCI(args[0], engine.board.moveList(isPurple), isPurple)
+		if err != nil {
+			engine.send("Illegal move: %s", args[0])
+			return false, nil
+		}
+		engine.play(m)
+		if engine.engineTurn() {
+			return false, engine.think()
+		}
+	case "undo":
+		engine.undo(1)
+	case "remove":
+		engine.undo(2)
+	case "result":
+		engine.over, engine.force = true, true
+	case "ping":
+		engine.send("pong %s", strings.Join(args, " "))
+	case "post":
+		engine.post = true
+	case "nopost":
+		engine.post = false
+	case "level":
+		if err := engine.level(args); err != nil {
+			engine.send("Error (%s): %s", err, strings.Join(fields, " "))
+		}
+	case "st":
+		seconds, err := strconv.ParseFloat(strings.Join(args, " "), 64)
+		if err != nil {
+			engine.send("Error (invalid time): %s", strings.Join(fields, " "))
+			return false, nil
+		}
+		engine.perMove = time.Duration(seconds * float64(time.Second))
+	case "sd":
+		depth, err := strconv.Atoi(strings.Join(args, " "))
+		if err != nil || depth < 1 {
+			engine.send("Error (invalid depth): %s", strings.Join(fields, " "))
+			return false, nil
+		}
+		if depth > uciDepthMax {
+			depth = uciDepthMax
+		}
+		engine.depth = depth
+	case "time":
+		centiseconds, err := strconv.Atoi(strings.Join(args, " "))
+		if err != nil {
+			engine.send("Error (invalid time): %s", strings.Join(fields, " "))
+			return false, nil
+		}
+		engine.clock = time.Duration(centiseconds) * 10 * time.Millisecond
+	case "quit":
+		return true, nil
+	default:
+		engine.send("Error (unknown command): %s", fields[0])
+	}
+	return false, nil
+}
+
+func xboardCommand(in io.Reader, out io.Writer) error {
+	engine := &xboardEngine{out: out, depth: 1}
+	engine.reset(initialBoard, 0)
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		quit, err := engine.command(fields)
+		if err != nil {
+			return err
+		}
+		if quit {
+			return nil
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+func xboardSession(c *C, input ...string) []string {
+	var out bytes.Buffer
+	c.Assert(xboardCommand(strings.NewReader(strings.Join(input, "\n")), &out), IsNil)
+	return strings.Split(strings.TrimSpace(out.String()), "\n")
+}
+
+func (s *NKnightSuite) TestXBoardHandshake(c *C) {
+	lines := xboardSession(c, "xboard", "protover 2", "ping 7", "bogus", "quit")
+	c.Assert(lines, HasLen, 3)
+	c.Assert(lines[0], Matches, `feature myname="nknight" .*setboard=1 usermove=1.* done=1`)
+	c.Assert(lines[1:], DeepEquals, []string{"pong 7", "Error (unknown command): bogus"})
+}
+
+func (s *NKnightSuite) TestXBoardUserMove(c *C) {
+	lines := xboardSession(c, "new", "usermove e2e5", "usermove e2e4", "quit")
+	c.Assert(lines, HasLen, 2)
+	c.Assert(lines[0], Equals, "Illegal move: e2e5")
+	c.Assert(lines[1], Matches, "move [a-h][1-8][a-h][1-8]")
+
+	lines = xboardSession(c, "new", "force", "usermove e2e4", "usermove e7e5", "post", "go", "quit")
+	c.Assert(lines, HasLen, 2)
+	c.Assert(lines[0], Matches, `1 -?\d+ \d+ 29 [a-h][1-8][a-h][1-8]`)
+	c.Assert(lines[1], Equals, "move "+strings.Fields(lines[0])[4])
+}
+
+func (s *NKnightSuite) TestXBoardThinksOnGoAndUserMove(c *C) {
+	lines := xboardSession(c, "new", "black", "level 40 5 0", "time 30000", "otim 30000", "setboard "+initialFEN, "quit")
+	c.Assert(lines, DeepEquals, []string{""})
+	lines = xboardSession(c, "new", "black", "level 40 5 0", "go", "quit")
+	c.Assert(lines, HasLen, 1)
+	c.Assert(lines[0], Matches, "move [a-h][1-8][a-h][1-8]")
+	lines = xboardSession(c, "new", "force", "usermove e2e4", "playother", "sd 2", "quit")
+	c.Assert(lines, DeepEquals, []string{""})
+}
+
+func (s *NKnightSuite) TestXBoardSetBoard(c *C) {
+	lines := xboardSession(c, "new", "force", "setboard 8/8", "setboard 6k1/5ppp/8/8/8/8/5PPP/R5K1 w - - 0 1", "usermove a1a8", "usermove g8f8", "quit")
+	c.Assert(lines, DeepEquals, []string{
+		"tellusererror Illegal position: fen is not 6 fields: 1",
+		"1-0 {checkmate}",
+		"Illegal move (game is over): g8f8",
+	})
+	lines = xboardSession(c, "new", "force", "setboard 6k1/5ppp/8/8/8/8/5PPP/R5K1 w - - 0 1", "sd 2", "go", "quit")
+	c.Assert(lines[0], Matches, "move [a-h][1-8][a-h][1-8]")
+	lines = xboardSession(c, "new", "force", "setboard 6k1/5ppp/8/8/8/8/5PPP/R5K1 w - - 0 1", "usermove a1a8", "undo", "usermove a1a7", "quit")
+	c.Assert(lines, DeepEquals, []string{"1-0 {checkmate}"})
+	lines = xboardSession(c, "new", "force", "setboard 4k3/8/8/8/8/8/8/1N2K1N1 w - - 0 1",
+		"usermove b1c3", "usermove e8d8", "usermove c3b1", "usermove d8e8",
+		"usermove b1c3", "usermove e8d8", "usermove c3b1", "usermove d8e8", "quit")
+	c.Assert(lines, DeepEquals, []string{"1/2-1/2 {threefold repetition}"})
+}
+
+func (s *NKnightSuite) TestXBoardTimeControls(c *C) {
+	engine := &xboardEngine{depth: 3}
+	engine.reset(initialBoard, 0)
+	c.Assert(engine.searchDepth(), Equals, 3)
+	c.Assert(engine.level([]string{"40", "5", "0"}), IsNil)
+	c.Assert(engine.clock, Equals, 5*time.Minute)
+	c.Assert(engine.searchDepth(), Equals, 3)
+	engine.clock = 100 * time.Second
+	c.Assert(engine.searchDepth(), Equals, 2)
+	c.Assert(engine.level([]string{"0", "0:20", "0"}), IsNil)
+	c.Assert(engine.clock, Equals, 20*time.Second)
+	c.Assert(engine.searchDepth(), Equals, 1)
+	c.Assert(engine.level([]string{"0", "x", "0"}), NotNil)
+	engine.perMove = 10 * time.Second
+	c.Assert(engine.searchDepth(), Equals, 3)
+}
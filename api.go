@@ -3,6 +3,7 @@ package main
 import (
 	"errors"
 	"net/http"
+	"net/url"
 	"path"
 
 	"github.com/labstack/echo/v4"
@@ -12,13 +13,29 @@ import (
 )
 
 type agentRequest struct {
-	Type   string
-	GameID uuid.UUID
+	Type     string
+	Name     string
+	GameID   uuid.UUID
+	Depth    int
+	Playouts int
+	MoveTime int
+}
+
+type gameRequest struct {
+	FEN string
 }
 
 type playRequest struct {
 	Board *chessState
+	Claim bool
 	Move  *move
+	SAN   string
+	UCI   string
+}
+
+type importResponse struct {
+	Href   string
+	Import pgnImport
 }
 
 type boardResponse struct {
@@ -26,6 +43,11 @@ type boardResponse struct {
 	Board Board
 }
 
+type evaluationResponse struct {
+	Href       string
+	Evaluation evaluation
+}
+
 type gameResponse struct {
 	Href string
 	Game Game
@@ -36,10 +58,23 @@ type gamesResponse struct {
 	Games []Game
 }
 
+type ratingsResponse struct {
+	Href    string
+	Players []Player
+}
+
+type ratingResponse struct {
+	Href    string
+	Player  Player
+	History []Rating
+}
+
 type playsResponse struct {
 	Href   string
 	Boards []chessState
 	Moves  []move
+	SAN    []string
+	UCI    []string
 }
 
 func errToHTTP(err error) error {
@@ -90,7 +125,13 @@ func responseGames(games []Game) gamesResponse {
 }
 
 func responsePlays(game *Game, boards []chessState, moves []move) playsResponse {
-	return playsResponse{Boards: boards, Moves: moves, Href: path.Join("/games", game.GameID.String(), "plays")}
+	san := make([]string, 0, len(moves))
+	uci := make([]string, 0, len(moves))
+	for _, m := range moves {
+		san = append(san, game.Board.Board.san(m, moves, game.ActiveAgentPurple))
+		uci = append(uci, m.uci(game.ActiveAgentPurple))
+	}
+	return playsResponse{Boards: boards, Moves: moves, SAN: san, UCI: uci, Href: path.Join("/games", game.GameID.String(), "plays")}
 }
 
 func apiHandler() *echo.Echo {
@@ -108,7 +149,7 @@ func apiHandler() *echo.Echo {
 		if err != nil {
 			return errToHTTP(err)
 		}
-		id, err := game.makeAgent(message.Type)
+		id, err := game.makeAgent(message.Type, message.Name, message.Depth, message.Playouts, message.MoveTime)
 		if err != nil {
 			return errToHTTP(err)
 		}
@@ -130,9 +171,25 @@ func apiHandler() *echo.Echo {
 		if err := c.Bind(&request); err != nil {
 			return err
 		}
+		if request.Claim {
+			if err := game.claimDraw(id); err != nil {
+				return errToHTTP(err)
+			}
+			return c.JSON(http.StatusOK, responseAgent(game, id))
+		}
 		if request.Board == nil && request.Move != nil {
 			request.Board = game.moveToBoard(*request.Move)
 		}
+		if request.Board == nil && request.SAN != "" {
+			if request.Board, err = game.sanToBoard(request.SAN); err != nil {
+				return errToHTTP(err)
+			}
+		}
+		if request.Board == nil && request.UCI != "" {
+			if request.Board, err = game.uciToBoard(request.UCI); err != nil {
+				return errToHTTP(err)
+			}
+		}
 		if err := game.playRound(id, request.Board); err != nil {
 			return errToHTTP(err)
 		}
@@ -153,7 +210,11 @@ func apiHandler() *echo.Echo {
 		return c.JSON(http.StatusOK, responseGames(games))
 	})
 	e.POST("/games", func(c echo.Context) error {
-		game, err := makeGame()
+		var message gameRequest
+		if err := c.Bind(&message); err != nil {
+			return err
+		}
+		game, err := makeGame(message.FEN)
 		if err != nil {
 			return errToHTTP(err)
 		}
@@ -177,6 +238,56 @@ func apiHandler() *echo.Echo {
 		}
 		return c.JSON(http.StatusOK, responsePlays(game, boards, moves))
 	})
+	e.GET("/games/:id/evaluation", func(c echo.Context) error {
+		game, err := requestGame(c)
+		if err != nil {
+			return errToHTTP(err)
+		}
+		return c.JSON(http.StatusOK, evaluationResponse{Evaluation: game.Board.Board.evaluate(), Href: path.Join("/games", game.GameID.String(), "evaluation")})
+	})
+
+	e.GET("/games/:id/pgn", func(c echo.Context) error {
+		id, err := requestID(c)
+		if err != nil {
+			return err
+		}
+		game, err := getGameUnscoped(id)
+		if err != nil {
+			return errToHTTP(err)
+		}
+		pgn, err := game.pgn()
+		if err != nil {
+			return errToHTTP(err)
+		}
+		return c.Blob(http.StatusOK, "application/x-chess-pgn", []byte(pgn))
+	})
+
+	e.GET("/ratings", func(c echo.Context) error {
+		players, err := getPlayers()
+		if err != nil {
+			return errToHTTP(err)
+		}
+		return c.JSON(http.StatusOK, ratingsResponse{Players: players, Href: "/ratings"})
+	})
+	e.GET("/ratings/:name", func(c echo.Context) error {
+		name, err := url.PathUnescape(c.Param("name"))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		player, history, err := getRatingHistory(name)
+		if err != nil {
+			return errToHTTP(err)
+		}
+		return c.JSON(http.StatusOK, ratingResponse{Player: player, History: history, Href: path.Join("/ratings", url.PathEscape(name))})
+	})
+
+	e.POST("/imports", func(c echo.Context) error {
+		summary, err := importPGN(c.Request().Body)
+		if err != nil {
+			return err
+		}
+		return c.JSON(http.StatusCreated, importResponse{Import: summary, Href: "/imports"})
+	})
 
 	e.File("/", "static/index.html")
 	e.File("/favicon.ico", "images/favicon.ico")
@@ -1,8 +1,10 @@
 package main
 
 import (
+	"encoding/json"
+	"fmt"
+
 	"gorm.io/gorm"
-	"gorm.io/gorm/clause"
 )
 
 // Board board.
@@ -11,15 +13,34 @@ type Board struct {
 
 	ActiveCheck       bool
 	ActiveCheckMate   bool
+	ActiveReturn      int
 	ActiveScore       int
 	Board             chessState `gorm:"<-:create;type:varchar;size:136;uniqueIndex;not null"`
 	Children          []Board    `gorm:"many2many:game_play"`
+	Hash              int64      `gorm:"<-:create;index"`
 	InactiveCheck     bool
 	InactiveCheckMate bool
+	InactiveReturn    int
 	InactiveScore     int
 	Moves             uint
 }
 
+// GamePlay game play, the edge from a board to a child board with the
+// results seen by the side moving along it.
+type GamePlay struct {
+	BoardID uint `gorm:"primaryKey"`
+	ChildID uint `gorm:"primaryKey"`
+	Visits  int  `gorm:"not null;default:0"`
+	Wins    int  `gorm:"not null;default:0"`
+	Draws   int  `gorm:"not null;default:0"`
+	Losses  int  `gorm:"not null;default:0"`
+}
+
+// TableName table name.
+func (GamePlay) TableName() string {
+	return "game_play"
+}
+
 type move struct {
 	piece     rune
 	depart    int
@@ -32,6 +53,64 @@ type move struct {
 
 type chessState [64]uint8
 
+type gameResult uint8
+
+const (
+	resultNone gameResult = iota
+	resultPurple
+	resultGreen
+	resultDraw
+	// resultUnknown ended before results were recorded.
+	resultUnknown
+)
+
+var resultToPGN = map[gameResult]string{
+	resultNone:    "*",
+	resultPurple:  "1-0",
+	resultGreen:   "0-1",
+	resultDraw:    "1/2-1/2",
+	resultUnknown: "*",
+}
+
+func (result gameResult) String() string {
+	return resultToPGN[result]
+}
+
+func (result gameResult) MarshalJSON() ([]byte, error) {
+	return json.Marshal(result.String())
+}
+
+func (result *gameResult) UnmarshalJSON(bytes []byte) error {
+	var s string
+	if err := json.Unmarshal(bytes, &s); err != nil {
+		return err
+	}
+	for r, pgn := range resultToPGN {
+		if pgn == s && r != resultUnknown {
+			*result = r
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid result %q", s)
+}
+
+// resultFromPGN reads a finished result from its PGN form.
+func resultFromPGN(s string) (gameResult, bool) {
+	for r, pgn := range resultToPGN {
+		if pgn == s && r != resultNone && r != resultUnknown {
+			return r, true
+		}
+	}
+	return resultNone, false
+}
+
+func winner(isPurple bool) gameResult {
+	if isPurple {
+		return resultPurple
+	}
+	return resultGreen
+}
+
 func (board chessState) makeMoveBase(isPurple bool, piece uint8, start int) move {
 	var p rune
 	if isPurple {
@@ -76,27 +155,21 @@ func (board chessState) makeMovePromotion(isPurple bool, piece uint8, start, end
 }
 
 func makeBoard(state chessState) (Board, error) {
-	var board Board
-	if err := db.FirstOrCreate(&board, Board{Board: state}).Error; err != nil {
-		return Board{}, err
-	}
-	return board, nil
+	return store.makeBoard(state)
+}
+
+// BeforeCreate sets the zobrist hash used to look boards up.
+func (board *Board) BeforeCreate(tx *gorm.DB) error {
+	board.Hash = int64(board.Board.zobrist())
+	return nil
 }
 
 func getBoard(id uint) (Board, error) {
-	var board Board
-	if err := db.Preload(clause.Associations).First(&board, id).Error; err != nil {
-		return Board{}, err
-	}
-	return board, nil
+	return store.getBoard(id)
 }
 
 func getBoardByBoard(state chessState) (Board, error) {
-	var board Board
-	if err := db.Preload(clause.Associations).Where(Board{Board: state}).First(&board).Error; err != nil {
-		return Board{}, err
-	}
-	return board, nil
+	return store.getBoardByBoard(state)
 }
 
 func (board chessState) swap() chessState {
@@ -123,6 +196,35 @@ func (board chessState) hasKings() bool {
 	return board.contains(king|1) && board.contains(king)
 }
 
-func (board Board) end() bool {
-	return (!board.Board.hasKings()) || board.ActiveCheckMate || board.InactiveCheckMate
+func (board chessState) inCheck(isPurple bool) bool {
+	for pos, piece := range board {
+		if piece&0xF == king|1 {
+			return board.attacked(pos, isPurple)
+		}
+	}
+	return false
+}
+
+func (board chessState) outcome() (gameResult, string) {
+	isPurple := board.activePurple()
+	if !board.contains(king | 1) {
+		return winner(!isPurple), "king captured"
+	} else if !board.contains(king) {
+		return winner(isPurple), "king captured"
+	}
+	if len(board.moveList(isPurple)) == 0 {
+		if board.inCheck(isPurple) {
+			return winner(!isPurple), "checkmate"
+		}
+		return resultDraw, "stalemate"
+	}
+	if board.insufficientMaterial() {
+		return resultDraw, "insufficient material"
+	}
+	return resultNone, ""
+}
+
+func (board Board) end() gameResult {
+	result, _ := board.Board.outcome()
+	return result
 }
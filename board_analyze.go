@@ -0,0 +1,51 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"time"
+)
+
+// analyzeCommand prints the evaluation terms, the network score and the
+// alphabeta best move of a position.
+func analyzeCommand(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("analyze", flag.ContinueOnError)
+	depth := flags.Int("depth", alphabetaDepth, "search depth in plies")
+	moveTime := flags.Duration("movetime", alphabetaMoveTime, "search time limit")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errors.New("usage: nknight analyze [-depth n] [-movetime d] <fen|startpos>")
+	}
+	fen := flags.Arg(0)
+	if fen == "startpos" {
+		fen = initialFEN
+	}
+	board, halfmove, fullmove, err := parseFEN(fen)
+	if err != nil {
+		return err
+	}
+	if *depth < 1 || *moveTime <= 0 {
+		return errors.New("depth and movetime must be positive")
+	}
+	isPurple := board.activePurple()
+	e := board.evaluate()
+	fmt.Fprintf(out, "fen %s\n", board.FEN(halfmove, fullmove))
+	fmt.Fprintf(out, "evaluation material %d piece-square %d mobility %d king-safety %d pawn-structure %d total %d\n", e.Material, e.PieceSquare, e.Mobility, e.KingSafety, e.PawnStructure, e.Total)
+	fmt.Fprintf(out, "neural %d\n", currentNetwork().evaluate(board))
+	fmt.Fprintf(out, "moves %d\n", len(board.moveList(isPurple)))
+	if result, termination := board.outcome(); result != resultNone {
+		fmt.Fprintf(out, "result %s {%s}\n", result, termination)
+		return nil
+	}
+	start := time.Now()
+	m, score, err := board.alphabeta(isPurple, *depth, *moveTime)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "bestmove %s san %s score cp %d time %s\n", m.uci(isPurple), board.san(m, board.moveList(isPurple), isPurple), score, time.Since(start).Round(time.Millisecond))
+	return nil
+}
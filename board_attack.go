@@ -0,0 +1,55 @@
+package main
+
+var knightSteps = [8][2]int{{1, 2}, {2, 1}, {2, -1}, {1, -2}, {-1, -2}, {-2, -1}, {-2, 1}, {-1, 2}}
+var kingSteps = [8][2]int{{0, 1}, {1, 1}, {1, 0}, {1, -1}, {0, -1}, {-1, -1}, {-1, 0}, {-1, 1}}
+var bishopSteps = [4][2]int{{1, 1}, {1, -1}, {-1, -1}, {-1, 1}}
+var rookSteps = [4][2]int{{0, 1}, {1, 0}, {0, -1}, {-1, 0}}
+
+func step(pos, fileStep, rankStep int) (int, bool) {
+	file := pos%8 + fileStep
+	rank := pos/8 + rankStep
+	if file < 0 || file > 7 || rank < 0 || rank > 7 {
+		return 0, false
+	}
+	return rank*8 + file, true
+}
+
+func (board chessState) attackedBySlider(pos int, steps [4][2]int, piece uint8) bool {
+	for _, s := range steps {
+		for end, ok := step(pos, s[0], s[1]); ok; end, ok = step(end, s[0], s[1]) {
+			if board[end]&0xE == 0 {
+				continue
+			}
+			if inactivePiece(board[end]) && (board[end]&0xE == piece || board[end]&0xE == queen) {
+				return true
+			}
+			break
+		}
+	}
+	return false
+}
+
+// attacked reports whether the inactive side attacks pos, isPurple being the
+// color of the active side.
+func (board chessState) attacked(pos int, isPurple bool) bool {
+	for _, s := range knightSteps {
+		if end, ok := step(pos, s[0], s[1]); ok && board[end]&0xF == knight {
+			return true
+		}
+	}
+	for _, s := range kingSteps {
+		if end, ok := step(pos, s[0], s[1]); ok && board[end]&0xF == king {
+			return true
+		}
+	}
+	rankStep := -1
+	if isPurple {
+		rankStep = 1
+	}
+	for _, fileStep := range []int{-1, 1} {
+		if end, ok := step(pos, fileStep, rankStep); ok && board[end]&0xF == pawn {
+			return true
+		}
+	}
+	return board.attackedBySlider(pos, bishopSteps, bishop) || board.attackedBySlider(pos, rookSteps, rook)
+}
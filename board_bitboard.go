@@ -0,0 +1,250 @@
+package main
+
+import "math/bits"
+
+type bitboard uint64
+
+// bitboardPosition bitboard position, indexed by color then piece type >> 1.
+type bitboardPosition struct {
+	pieces   [2][8]bitboard
+	occupied [2]bitboard
+	passant  int
+	castle   [2][2]bool
+	purple   bool
+}
+
+// rayDirections rook directions followed by bishop directions.
+var rayDirections = [8][2]int{{0, 1}, {1, 0}, {0, -1}, {-1, 0}, {1, 1}, {1, -1}, {-1, -1}, {-1, 1}}
+
+var knightAttacks [64]bitboard
+var kingAttacks [64]bitboard
+var pawnAttacks [2][64]bitboard
+var rays [8][64]bitboard
+
+func init() {
+	for sq := 0; sq < 64; sq++ {
+		for _, s := range knightSteps {
+			if end, ok := step(sq, s[0], s[1]); ok {
+				knightAttacks[sq] |= bit(end)
+			}
+		}
+		for _, s := range kingSteps {
+			if end, ok := step(sq, s[0], s[1]); ok {
+				kingAttacks[sq] |= bit(end)
+			}
+		}
+		for _, fileStep := range []int{-1, 1} {
+			if end, ok := step(sq, fileStep, 1); ok {
+				pawnAttacks[colorIndex(true)][sq] |= bit(end)
+			}
+			if end, ok := step(sq, fileStep, -1); ok {
+				pawnAttacks[colorIndex(false)][sq] |= bit(end)
+			}
+		}
+		for dir, s := range rayDirections {
+			for end, ok := step(sq, s[0], s[1]); ok; end, ok = step(end, s[0], s[1]) {
+				rays[dir][sq] |= bit(end)
+			}
+		}
+	}
+}
+
+func bit(sq int) bitboard {
+	return bitboard(1) << uint(sq)
+}
+
+func colorIndex(isPurple bool) int {
+	if isPurple {
+		return 0
+	}
+	return 1
+}
+
+func (b bitboard) first() int {
+	return bits.TrailingZeros64(uint64(b))
+}
+
+func (b bitboard) last() int {
+	return 63 - bits.LeadingZeros64(uint64(b))
+}
+
+func rayAttacks(dir, sq int, occupied bitboard) bitboard {
+	attacks := rays[dir][sq]
+	blockers := attacks & occupied
+	if blockers == 0 {
+		return attacks
+	}
+	s := rayDirections[dir]
+	if s[1]*8+s[0] > 0 {
+		return attacks ^ rays[dir][blockers.first()]
+	}
+	return attacks ^ rays[dir][blockers.last()]
+}
+
+func rookAttacks(sq int, occupied bitboard) bitboard {
+	return rayAttacks(0, sq, occupied) | rayAttacks(1, sq, occupied) | rayAttacks(2, sq, occupied) | rayAttacks(3, sq, occupied)
+}
+
+func bishopAttacks(sq int, occupied bitboard) bitboard {
+	return rayAttacks(4, sq, occupied) | rayAttacks(5, sq, occupied) | rayAttacks(6, sq, occupied) | rayAttacks(7, sq, occupied)
+}
+
+func (board chessState) bitboards(isPurple bool) bitboardPosition {
+	bb := bitboardPosition{passant: -1, purple: isPurple}
+	for sq, piece := range board {
+		if piece&0xE == 0 {
+			continue
+		}
+		color := colorIndex(isPurple == activePiece(piece))
+		bb.pieces[color][piece&0xE>>1] |= bit(sq)
+		bb.occupied[color] |= bit(sq)
+	}
+	for _, isPurple := range []bool{true, false} {
+		bb.castle[colorIndex(isPurple)][0] = board.castleRight(isPurple, 'h')
+		bb.castle[colorIndex(isPurple)][1] = board.castleRight(isPurple, 'a')
+	}
+	if target, ok := board.passantTarget(); ok {
+		bb.passant = target
+	}
+	return bb
+}
+
+// attacked reports whether the inactive side attacks sq once the squares in
+// captured are removed from its pieces.
+func (bb *bitboardPosition) attacked(sq int, occupied, captured bitboard) bool {
+	us := colorIndex(bb.purple)
+	them := &bb.pieces[1-us]
+	queens := them[queen>>1]
+	return knightAttacks[sq]&them[knight>>1]&^captured != 0 ||
+		kingAttacks[sq]&them[king>>1] != 0 ||
+		pawnAttacks[us][sq]&them[pawn>>1]&^captured != 0 ||
+		bishopAttacks(sq, occupied)&(them[bishop>>1]|queens)&^captured != 0 ||
+		rookAttacks(sq, occupied)&(them[rook>>1]|queens)&^captured != 0
+}
+
+func (bb *bitboardPosition) legal(piece uint8, start, end, capture int) bool {
+	us := colorIndex(bb.purple)
+	captured := bitboard(0)
+	if capture >= 0 {
+		captured = bit(capture)
+	}
+	occupied := (bb.occupied[0]|bb.occupied[1])&^(bit(start)|captured) | bit(end)
+	kingSq := bb.pieces[us][king>>1].first()
+	if piece == king {
+		kingSq = end
+	}
+	return !bb.attacked(kingSq, occupied, captured)
+}
+
+func (bb *bitboardPosition) appendMove(moves []move, piece uint8, start, end int) []move {
+	capture := -1
+	if bb.occupied[1-colorIndex(bb.purple)]&bit(end) != 0 {
+		capture = end
+	}
+	if !bb.legal(piece, start, end, capture) {
+		return moves
+	}
+	m := move{piece: figurine(bb.purple, piece), depart: start, capture: capture >= 0, dest: end}
+	_, rank := rankAndFile(end)
+	if piece != pawn || (rank != 1 && rank != 8) {
+		return append(moves, m)
+	}
+	for _, promotion := range []uint8{bishop, knight, queen, rook} {
+		m.promotion = figurine(bb.purple, promotion)
+		moves = append(moves, m)
+	}
+	return moves
+}
+
+func (bb *bitboardPosition) appendPawnMoves(moves []move) []move {
+	us := colorIndex(bb.purple)
+	occupied := bb.occupied[0] | bb.occupied[1]
+	forward, home := 8, 1
+	if !bb.purple {
+		forward, home = -8, 6
+	}
+	for pawns := bb.pieces[us][pawn>>1]; pawns != 0; pawns &= pawns - 1 {
+		start := pawns.first()
+		end := start + forward
+		if occupied&bit(end) == 0 {
+			moves = bb.appendMove(moves, pawn, start, end)
+			if start/8 == home && occupied&bit(end+forward) == 0 {
+				moves = bb.appendMove(moves, pawn, start, end+forward)
+			}
+		}
+		for targets := pawnAttacks[us][start] & bb.occupied[1-us]; targets != 0; targets &= targets - 1 {
+			moves = bb.appendMove(moves, pawn, start, targets.first())
+		}
+		if bb.passant >= 0 && pawnAttacks[us][start]&bit(bb.passant) != 0 {
+			capture := bb.passant - forward
+			if bb.legal(pawn, start, bb.passant, capture) {
+				moves = append(moves, move{piece: figurine(bb.purple, pawn), depart: start, capture: true, dest: bb.passant})
+			}
+		}
+	}
+	return moves
+}
+
+func (bb *bitboardPosition) appendCastleMoves(moves []move) []move {
+	us := colorIndex(bb.purple)
+	start := bb.pieces[us][king>>1].first()
+	occupied := bb.occupied[0] | bb.occupied[1]
+	if bb.attacked(start, occupied, 0) {
+		return moves
+	}
+	if bb.castle[us][0] && occupied&(bit(start+1)|bit(start+2)) == 0 &&
+		!bb.attacked(start+1, occupied, 0) && !bb.attacked(start+2, occupied, 0) {
+		moves = append(moves, move{piece: figurine(bb.purple, king), depart: start, castling: 'k'})
+	}
+	if bb.castle[us][1] && occupied&(bit(start-1)|bit(start-2)|bit(start-3)) == 0 &&
+		!bb.attacked(start-1, occupied, 0) && !bb.attacked(start-2, occupied, 0) {
+		moves = append(moves, move{piece: figurine(bb.purple, king), depart: start, castling: 'q'})
+	}
+	return moves
+}
+
+func (bb *bitboardPosition) appendMoves(moves []move) []move {
+	us := colorIndex(bb.purple)
+	if bb.pieces[us][king>>1] == 0 || bb.pieces[1-us][king>>1] == 0 {
+		return moves
+	}
+	occupied := bb.occupied[0] | bb.occupied[1]
+	for _, piece := range []uint8{bishop, king, knight, queen, rook} {
+		for pieces := bb.pieces[us][piece>>1]; pieces != 0; pieces &= pieces - 1 {
+			start := pieces.first()
+			var targets bitboard
+			switch piece {
+			case bishop:
+				targets = bishopAttacks(start, occupied)
+			case king:
+				targets = kingAttacks[start]
+			case knight:
+				targets = knightAttacks[start]
+			case queen:
+				targets = bishopAttacks(start, occupied) | rookAttacks(start, occupied)
+			case rook:
+				targets = rookAttacks(start, occupied)
+			}
+			for targets = targets &^ bb.occupied[us]; targets != 0; targets &= targets - 1 {
+				moves = bb.appendMove(moves, piece, start, targets.first())
+			}
+		}
+	}
+	moves = bb.appendPawnMoves(moves)
+	return bb.appendCastleMoves(moves)
+}
+
+func figurine(isPurple bool, piece uint8) rune {
+	if isPurple {
+		return valueToPiecePurple[piece]
+	}
+	return valueToPieceGreen[piece]
+}
+
+// bitboardGenerator bitboard move generator.
+type bitboardGenerator struct{}
+
+func (bitboardGenerator) appendMoves(moves []move, board chessState, isPurple bool) []move {
+	bb := board.bitboards(isPurple)
+	return bb.appendMoves(moves)
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"sort"
+
+	. "gopkg.in/check.v1"
+)
+
+const kiwipeteFEN = "r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1"
+
+func uciList(moves []move, isPurple bool) []string {
+	list := make([]string, 0, len(moves))
+	for _, m := range moves {
+		list = append(list, m.uci(isPurple))
+	}
+	sort.Strings(list)
+	return list
+}
+
+func (s *NKnightSuite) TestBitboardGenerator(c *C) {
+	for _, position := range perftPositions {
+		board, _, _, err := parseFEN(position.fen)
+		c.Assert(err, IsNil)
+		isPurple := board.activePurple()
+		channel := channelGenerator{}.appendMoves(nil, board, isPurple)
+		bitboard := bitboardGenerator{}.appendMoves(nil, board, isPurple)
+		c.Assert(uciList(bitboard, isPurple), DeepEquals, uciList(channel, isPurple), Commentf(position.fen))
+		c.Assert(board.perftWith(bitboardGenerator{}, make([][]move, 2)), Equals, board.perftWith(channelGenerator{}, make([][]move, 2)))
+	}
+	board := initialBoard
+	board[position('e', 8)] = 0
+	c.Assert(bitboardGenerator{}.appendMoves(nil, board, true), HasLen, 0)
+}
+
+func (s *NKnightSuite) TestBitboardAttacks(c *C) {
+	c.Assert(knightAttacks[position('a', 1)], Equals, bit(position('b', 3))|bit(position('c', 2)))
+	c.Assert(pawnAttacks[colorIndex(true)][position('h', 2)], Equals, bit(position('g', 3)))
+	c.Assert(pawnAttacks[colorIndex(false)][position('a', 7)], Equals, bit(position('b', 6)))
+	occupied := bit(position('d', 6)) | bit(position('f', 4))
+	c.Assert(rookAttacks(position('d', 4), occupied)&bit(position('d', 7)), Equals, bitboard(0))
+	c.Assert(rookAttacks(position('d', 4), occupied)&bit(position('f', 4)), Not(Equals), bitboard(0))
+	c.Assert(bishopAttacks(position('a', 1), occupied), Equals, rays[4][position('a', 1)])
+}
+
+func benchmarkPerft(c *C, gen moveGenerator) {
+	board, _, _, err := parseFEN(kiwipeteFEN)
+	c.Assert(err, IsNil)
+	buffers := make([][]move, 2)
+	c.ResetTimer()
+	for i := 0; i < c.N; i++ {
+		board.perftWith(gen, buffers)
+	}
+}
+
+func (s *NKnightSuite) BenchmarkPerftChannel(c *C) {
+	benchmarkPerft(c, channelGenerator{})
+}
+
+func (s *NKnightSuite) BenchmarkPerftBitboard(c *C) {
+	benchmarkPerft(c, bitboardGenerator{})
+}
+
+func benchmarkMoves(c *C, gen moveGenerator) {
+	board, _, _, err := parseFEN(kiwipeteFEN)
+	c.Assert(err, IsNil)
+	moves := make([]move, 0, 256)
+	c.ResetTimer()
+	for i := 0; i < c.N; i++ {
+		moves = gen.appendMoves(moves[:0], board, true)
+	}
+}
+
+func (s *NKnightSuite) BenchmarkMovesChannel(c *C) {
+	benchmarkMoves(c, channelGenerator{})
+}
+
+func (s *NKnightSuite) BenchmarkMovesBitboard(c *C) {
+	benchmarkMoves(c, bitboardGenerator{})
+}
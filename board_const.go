@@ -10,17 +10,26 @@ const (
 	rook   uint8 = iota << 1
 )
 
+const (
+	activeFlag  uint8 = 0x01
+	castleFlag  uint8 = 0x10
+	purpleFlag  uint8 = 0x20
+	passantFlag uint8 = 0x40
+)
+
 var initialBoard = chessState{
-	rook, knight, bishop, queen, king, bishop, knight, rook,
-	pawn, pawn, pawn, pawn, pawn, pawn, pawn, pawn,
+	rook | 0x31, knight | 0x21, bishop | 0x21, queen | 0x21, king | 0x31, bishop | 0x21, knight | 0x21, rook | 0x31,
+	pawn | 0x21, pawn | 0x21, pawn | 0x21, pawn | 0x21, pawn | 0x21, pawn | 0x21, pawn | 0x21, pawn | 0x21,
 	0, 0, 0, 0, 0, 0, 0, 0,
 	0, 0, 0, 0, 0, 0, 0, 0,
 	0, 0, 0, 0, 0, 0, 0, 0,
 	0, 0, 0, 0, 0, 0, 0, 0,
-	pawn | 1, pawn | 1, pawn | 1, pawn | 1, pawn | 1, pawn | 1, pawn | 1, pawn | 1,
-	rook | 1, knight | 1, bishop | 1, queen | 1, king | 1, bishop | 1, knight | 1, rook | 1,
+	pawn, pawn, pawn, pawn, pawn, pawn, pawn, pawn,
+	rook | 0x10, knight, bishop, queen, king | 0x10, bishop, knight, rook | 0x10,
 }
 
+const initialFEN = "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1"
+
 var valueToPieceGreen = map[uint8]rune{
 	bishop: '♝',
 	king:   '♚',
@@ -53,3 +62,19 @@ var pieceToValuePurple = map[rune]uint8{
 	'♕': queen,
 	'♖': rook,
 }
+var valueToFEN = map[uint8]byte{
+	bishop: 'b',
+	king:   'k',
+	knight: 'n',
+	pawn:   'p',
+	queen:  'q',
+	rook:   'r',
+}
+var fenToValue = map[byte]uint8{
+	'b': bishop,
+	'k': king,
+	'n': knight,
+	'p': pawn,
+	'q': queen,
+	'r': rook,
+}
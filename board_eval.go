@@ -0,0 +1,236 @@
+package main
+
+import "math/bits"
+
+const (
+	// evalScale centipawns per point of board score.
+	evalScale = 100
+	// evalLimit largest static board score, far below the winScore of a
+	// finished game.
+	evalLimit       = 10
+	mobilityWeight  = 4
+	shieldWeight    = 10
+	kingZoneWeight  = 10
+	doubledWeight   = 20
+	isolatedWeight  = 15
+	passedRankBonus = 10
+)
+
+// pieceSquares piece-square tables indexed by piece type >> 1, laid out from
+// rank 8 down so purple reads them at sq ^ 56 and green at sq.
+var pieceSquares = [8][64]int{
+	bishop >> 1: {
+		-20, -10, -10, -10, -10, -10, -10, -20,
+		-10, 0, 0, 0, 0, 0, 0, -10,
+		-10, 0, 5, 10, 10, 5, 0, -10,
+		-10, 5, 5, 10, 10, 5, 5, -10,
+		-10, 0, 10, 10, 10, 10, 0, -10,
+		-10, 10, 10, 10, 10, 10, 10, -10,
+		-10, 5, 0, 0, 0, 0, 5, -10,
+		-20, -10, -10, -10, -10, -10, -10, -20,
+	},
+	king >> 1: {
+		-30, -40, -40, -50, -50, -40, -40, -30,
+		-30, -40, -40, -50, -50, -40, -40, -30,
+		-30, -40, -40, -50, -50, -40, -40, -30,
+		-30, -40, -40, -50, -50, -40, -40, -30,
+		-20, -30, -30, -40, -40, -30, -30, -20,
+		-10, -20, -20, -20, -20, -20, -20, -10,
+		20, 20, 0, 0, 0, 0, 20, 20,
+		20, 30, 10, 0, 0, 10, 30, 20,
+	},
+	knight >> 1: {
+		-50, -40, -30, -30, -30, -30, -40, -50,
+		-40, -20, 0, 0, 0, 0, -20, -40,
+		-30, 0, 10, 15, 15, 10, 0, -30,
+		-30, 5, 15, 20, 20, 15, 5, -30,
+		-30, 0, 15, 20, 20, 15, 0, -30,
+		-30, 5, 10, 15, 15, 10, 5, -30,
+		-40, -20, 0, 5, 5, 0, -20, -40,
+		-50, -40, -30, -30, -30, -30, -40, -50,
+	},
+	pawn >> 1: {
+		0, 0, 0, 0, 0, 0, 0, 0,
+		50, 50, 50, 50, 50, 50, 50, 50,
+		10, 10, 20, 30, 30, 20, 10, 10,
+		5, 5, 10, 25, 25, 10, 5, 5,
+		0, 0, 0, 20, 20, 0, 0, 0,
+		5, -5, -10, 0, 0, -10, -5, 5,
+		5, 10, 10, -20, -20, 10, 10, 5,
+		0, 0, 0, 0, 0, 0, 0, 0,
+	},
+	queen >> 1: {
+		-20, -10, -10, -5, -5, -10, -10, -20,
+		-10, 0, 0, 0, 0, 0, 0, -10,
+		-10, 0, 5, 5, 5, 5, 0, -10,
+		-5, 0, 5, 5, 5, 5, 0, -5,
+		0, 0, 5, 5, 5, 5, 0, -5,
+		-10, 5, 5, 5, 5, 5, 0, -10,
+		-10, 0, 5, 0, 0, 0, 0, -10,
+		-20, -10, -10, -5, -5, -10, -10, -20,
+	},
+	rook >> 1: {
+		0, 0, 0, 0, 0, 0, 0, 0,
+		5, 10, 10, 10, 10, 10, 10, 5,
+		-5, 0, 0, 0, 0, 0, 0, -5,
+		-5, 0, 0, 0, 0, 0, 0, -5,
+		-5, 0, 0, 0, 0, 0, 0, -5,
+		-5, 0, 0, 0, 0, 0, 0, -5,
+		-5, 0, 0, 0, 0, 0, 0, -5,
+		0, 0, 0, 5, 5, 0, 0, 0,
+	},
+}
+
+var fileMasks [8]bitboard
+
+// passedMasks squares ahead of a pawn on its own and adjacent files, indexed
+// by color then square.
+var passedMasks [2][64]bitboard
+
+func init() {
+	for sq := 0; sq < 64; sq++ {
+		fileMasks[sq%8] |= bit(sq)
+	}
+	for sq := 0; sq < 64; sq++ {
+		for file := sq%8 - 1; file <= sq%8+1; file++ {
+			if file < 0 || file > 7 {
+				continue
+			}
+			for rank := 0; rank < 8; rank++ {
+				if rank > sq/8 {
+					passedMasks[colorIndex(true)][sq] |= bit(rank*8 + file)
+				} else if rank < sq/8 {
+					passedMasks[colorIndex(false)][sq] |= bit(rank*8 + file)
+				}
+			}
+		}
+	}
+}
+
+// evaluation static evaluation terms in centipawns for the active side.
+type evaluation struct {
+	Material      int
+	PieceSquare   int
+	Mobility      int
+	KingSafety    int
+	PawnStructure int
+	Total         int
+}
+
+func (b bitboard) count() int {
+	return bits.OnesCount64(uint64(b))
+}
+
+func (bb *bitboardPosition) pieceSquare(color int) int {
+	score := 0
+	for piece := range bb.pieces[color] {
+		for pieces := bb.pieces[color][piece]; pieces != 0; pieces &= pieces - 1 {
+			sq := pieces.first()
+			if color == colorIndex(true) {
+				sq = sq ^ 56
+			}
+			score = score + pieceSquares[piece][sq]
+		}
+	}
+	return score
+}
+
+func (bb *bitboardPosition) mobility(color int) int {
+	occupied := bb.occupied[0] | bb.occupied[1]
+	pieces := &bb.pieces[color]
+	attacks := 0
+	for p := pieces[knight>>1]; p != 0; p &= p - 1 {
+		attacks = attacks + (knightAttacks[p.first()] &^ bb.occupied[color]).count()
+	}
+	for p := pieces[bishop>>1] | pieces[queen>>1]; p != 0; p &= p - 1 {
+		attacks = attacks + (bishopAttacks(p.first(), occupied) &^ bb.occupied[color]).count()
+	}
+	for p := pieces[rook>>1] | pieces[queen>>1]; p != 0; p &= p - 1 {
+		attacks = attacks + (rookAttacks(p.first(), occupied) &^ bb.occupied[color]).count()
+	}
+	return mobilityWeight * attacks
+}
+
+// kingSafety rewards pawns next to the king and penalises squares around it
+// the other side attacks.
+func (bb *bitboardPosition) kingSafety(color int) int {
+	kings := bb.pieces[color][king>>1]
+	if kings == 0 {
+		return 0
+	}
+	zone := kingAttacks[kings.first()]
+	score := shieldWeight * (zone & bb.pieces[color][pawn>>1]).count()
+	side := *bb
+	side.purple = color == colorIndex(true)
+	occupied := bb.occupied[0] | bb.occupied[1]
+	for squares := zone; squares != 0; squares &= squares - 1 {
+		if side.attacked(squares.first(), occupied, 0) {
+			score = score - kingZoneWeight
+		}
+	}
+	return score
+}
+
+// pawnStructure penalises doubled and isolated pawns and rewards passed pawns
+// by how far they have advanced.
+func (bb *bitboardPosition) pawnStructure(color int) int {
+	pawns := bb.pieces[color][pawn>>1]
+	theirs := bb.pieces[1-color][pawn>>1]
+	score := 0
+	for file, mask := range fileMasks {
+		count := (pawns & mask).count()
+		if count > 1 {
+			score = score - doubledWeight*(count-1)
+		}
+		neighbours := bitboard(0)
+		if file > 0 {
+			neighbours |= fileMasks[file-1]
+		}
+		if file < 7 {
+			neighbours |= fileMasks[file+1]
+		}
+		if count > 0 && pawns&neighbours == 0 {
+			score = score - isolatedWeight*count
+		}
+	}
+	for p := pawns; p != 0; p &= p - 1 {
+		sq := p.first()
+		if passedMasks[color][sq]&theirs == 0 {
+			rank := sq / 8
+			if color != colorIndex(true) {
+				rank = 7 - rank
+			}
+			score = score + passedRankBonus*rank
+		}
+	}
+	return score
+}
+
+// evaluate scores the board for the active side.
+func (board chessState) evaluate() evaluation {
+	isPurple := board.activePurple()
+	bb := board.bitboards(isPurple)
+	us, them := colorIndex(isPurple), colorIndex(!isPurple)
+	e := evaluation{
+		Material:      board.material(),
+		PieceSquare:   bb.pieceSquare(us) - bb.pieceSquare(them),
+		Mobility:      bb.mobility(us) - bb.mobility(them),
+		KingSafety:    bb.kingSafety(us) - bb.kingSafety(them),
+		PawnStructure: bb.pawnStructure(us) - bb.pawnStructure(them),
+	}
+	e.Total = e.Material + e.PieceSquare + e.Mobility + e.KingSafety + e.PawnStructure
+	return e
+}
+
+// score board score for the active side, in points of evalScale centipawns
+// capped at evalLimit.
+func (e evaluation) score() int {
+	score := e.Total / evalScale
+	if score > evalLimit {
+		return evalLimit
+	}
+	if score < -evalLimit {
+		return -evalLimit
+	}
+	return score
+}
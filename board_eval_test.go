@@ -0,0 +1,69 @@
+package main
+
+import (
+	. "gopkg.in/check.v1"
+)
+
+func evaluateFEN(c *C, fen string) evaluation {
+	board, _, _, err := parseFEN(fen)
+	c.Assert(err, IsNil)
+	return board.evaluate()
+}
+
+func (s *NKnightSuite) TestEvaluate(c *C) {
+	c.Assert(initialBoard.evaluate(), DeepEquals, evaluation{})
+	c.Assert(evaluateFEN(c, "r3k2r/Pppp1ppp/1b3nbN/nP6/BBP1P3/q4N2/Pp1P2PP/R2Q1RK1 w kq - 0 1"), DeepEquals,
+		evaluateFEN(c, "r2q1rk1/pP1p2pp/Q4n2/bbp1p3/Np6/1B3NBn/pPPP1PPP/R3K2R b KQ - 0 1"))
+	e := evaluateFEN(c, "4k3/8/8/8/8/P7/P7/4K3 w - - 0 1")
+	c.Assert(e.PawnStructure, Equals, -20)
+	e = evaluateFEN(c, "4k3/8/8/8/8/8/3PPP2/4K3 w - - 0 1")
+	c.Assert(e.KingSafety, Equals, 30)
+	c.Assert(evaluateFEN(c, "4k3/8/8/8/8/8/3PPP2/4K3 b - - 0 1").KingSafety, Equals, -30)
+	e = evaluateFEN(c, "4k3/8/8/8/8/8/8/3QK3 w - - 0 1")
+	c.Assert(e.Material, Equals, 900)
+	c.Assert(e.Mobility > 0, Equals, true)
+	c.Assert(e.Total, Equals, e.Material+e.PieceSquare+e.Mobility+e.KingSafety+e.PawnStructure)
+	c.Assert(e.score(), Equals, e.Total/evalScale)
+}
+
+func (s *NKnightSuite) TestMakeBoardEvaluate(c *C) {
+	state, _, _, err := parseFEN("4k3/8/8/8/8/8/8/2QQK3 b - - 0 1")
+	c.Assert(err, IsNil)
+	board, err := makeBoard(state)
+	c.Assert(err, IsNil)
+	c.Assert(board.ActiveScore, Equals, state.evaluate().score())
+	c.Assert(board.ActiveScore, Equals, -evalLimit)
+	c.Assert(board.InactiveScore, Equals, -board.ActiveScore)
+}
+
+func (s *NKnightSuite) TestGameEvaluation(c *C) {
+	var game gameResponse
+	s.post201(c, "games", gameRequest{FEN: "4k3/8/8/8/8/8/8/3QK3 w - - 0 1"}, &game)
+	var response evaluationResponse
+	s.get200(c, "games/"+game.Game.GameID.String()+"/evaluation", &response)
+	c.Assert(response.Href, Equals, "/games/"+game.Game.GameID.String()+"/evaluation")
+	c.Assert(response.Evaluation, DeepEquals, evaluateFEN(c, "4k3/8/8/8/8/8/8/3QK3 w - - 0 1"))
+	s.get404(c, "games/"+placeHolder.String()+"/evaluation")
+}
+
+func (s *NKnightSuite) TestDecideCheckMate(c *C) {
+	boards := []Board{{InactiveScore: 50 * evalLimit}, {ActiveCheckMate: true, ActiveScore: lossScore, InactiveScore: winScore, Board: initialBoard}, {InactiveScore: 40 * evalLimit}}
+	c.Assert(decide(boards), Equals, initialBoard)
+	c.Assert(bestChild(boards).Board, Equals, initialBoard)
+	c.Assert(bestChild(boards[2:]).InactiveScore, Equals, 40*evalLimit)
+}
+
+func (s *NKnightSuite) TestMateOutscoresMaterial(c *C) {
+	state, _, _, err := parseFEN("6k1/5ppp/8/8/8/8/5PPP/R2n2K1 w - - 0 1")
+	c.Assert(err, IsNil)
+	board, err := makeBoard(state)
+	c.Assert(err, IsNil)
+	board, err = getBoard(board.ID)
+	c.Assert(err, IsNil)
+	c.Assert(board.lookaheadDepth(true, 2, nil), IsNil)
+	board, err = getBoard(board.ID)
+	c.Assert(err, IsNil)
+	mate, _, _, err := parseFEN("R5k1/5ppp/8/8/8/8/5PPP/3n2K1 b - - 1 1")
+	c.Assert(err, IsNil)
+	c.Assert(bestChild(board.Children).Board, Equals, mate)
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+func colorFlag(isPurple bool) uint8 {
+	if isPurple {
+		return purpleFlag
+	}
+	return 0
+}
+
+func (board chessState) activePurple() bool {
+	for _, piece := range board {
+		if activePiece(piece) {
+			return piece&purpleFlag != 0
+		}
+	}
+	return true
+}
+
+func (board chessState) castleRight(isPurple bool, rookFile byte) bool {
+	rank := uint(1)
+	if !isPurple {
+		rank = 8
+	}
+	color := colorFlag(isPurple) | castleFlag
+	return board[position('e', rank)]&^activeFlag == king|color && board[position(rookFile, rank)]&^activeFlag == rook|color
+}
+
+func (board chessState) passantTarget() (int, bool) {
+	for pos, piece := range board {
+		if piece&passantFlag == 0 {
+			continue
+		}
+		if piece&purpleFlag != 0 {
+			return pos - 8, true
+		}
+		return pos + 8, true
+	}
+	return 0, false
+}
+
+func parseFEN(fen string) (chessState, int, int, error) {
+	var board chessState
+	fields := strings.Fields(fen)
+	if len(fields) != 6 {
+		return board, 0, 0, fmt.Errorf("fen is not 6 fields: %d", len(fields))
+	}
+	ranks := strings.Split(fields[0], "/")
+	if len(ranks) != 8 {
+		return board, 0, 0, fmt.Errorf("fen is not 8 ranks: %d", len(ranks))
+	}
+	for i, row := range ranks {
+		rank := uint(8 - i)
+		file := byte('a')
+		for _, c := range []byte(row) {
+			if file > 'h' {
+				return board, 0, 0, fmt.Errorf("rank %d is longer than 8: %s", rank, row)
+			}
+			if c >= '1' && c <= '8' {
+				file = file + c - '0'
+				continue
+			}
+			piece, ok := fenToValue[c|0x20]
+			if !ok {
+				return board, 0, 0, fmt.Errorf("invalid piece %q in rank %d", c, rank)
+			}
+			if c < 'a' {
+				piece = piece | purpleFlag
+			}
+			board[position(file, rank)] = piece
+			file = file + 1
+		}
+		if file != 'i' {
+			return board, 0, 0, fmt.Errorf("rank %d is not length 8: %s", rank, row)
+		}
+	}
+	var isPurple bool
+	switch fields[1] {
+	case "w":
+		isPurple = true
+	case "b":
+		isPurple = false
+	default:
+		return board, 0, 0, fmt.Errorf("invalid active color %q", fields[1])
+	}
+	for pos, piece := range board {
+		if piece != 0 && (piece&purpleFlag != 0) == isPurple {
+			board[pos] = piece | activeFlag
+		}
+	}
+	if fields[2] != "-" {
+		for _, c := range []byte(fields[2]) {
+			rank := uint(1)
+			if c >= 'a' {
+				rank = 8
+			}
+			var rookFile byte
+			switch c | 0x20 {
+			case 'k':
+				rookFile = 'h'
+			case 'q':
+				rookFile = 'a'
+			default:
+				return board, 0, 0, fmt.Errorf("invalid castling availability %q", fields[2])
+			}
+			color := colorFlag(rank == 1)
+			kingPos := position('e', rank)
+			rookPos := position(rookFile, rank)
+			if board[kingPos]&0x2E != king|color || board[rookPos]&0x2E != rook|color {
+				return board, 0, 0, fmt.Errorf("castling availability %q without king and rook in place", c)
+			}
+			board[kingPos] = board[kingPos] | castleFlag
+			board[rookPos] = board[rookPos] | castleFlag
+		}
+	}
+	if fields[3] != "-" {
+		s := fields[3]
+		if len(s) != 2 || s[0] < 'a' || s[0] > 'h' || (isPurple && s[1] != '6') || (!isPurple && s[1] != '3') {
+			return board, 0, 0, fmt.Errorf("invalid en passant target %q", s)
+		}
+		target := position(s[0], uint(s[1]-'0'))
+		pos := target - 8
+		if !isPurple {
+			pos = target + 8
+		}
+		if board[target] != 0 || board[pos]&0xF != pawn {
+			return board, 0, 0, fmt.Errorf("en passant target %q without pawn in place", s)
+		}
+		// Like movePawn, only mark the pawn when an enemy pawn beside it can
+		// capture, so the position matches the one reached by playing.
+		if (s[0] > 'a' && board[pos-1]&0xF == pawn|activeFlag) || (s[0] < 'h' && board[pos+1]&0xF == pawn|activeFlag) {
+			board[pos] = board[pos] | passantFlag
+		}
+	}
+	halfmove, err := strconv.Atoi(fields[4])
+	if err != nil || halfmove < 0 {
+		return board, 0, 0, fmt.Errorf("invalid halfmove clock %q", fields[4])
+	}
+	fullmove, err := strconv.Atoi(fields[5])
+	if err != nil || fullmove < 1 {
+		return board, 0, 0, fmt.Errorf("invalid fullmove number %q", fields[5])
+	}
+	return board, halfmove, fullmove, nil
+}
+
+// FEN renders the position in Forsyth-Edwards Notation.
+func (board chessState) FEN(halfmove, fullmove int) string {
+	var fen strings.Builder
+	for rank := uint(8); rank >= 1; rank-- {
+		empty := byte(0)
+		for file := byte('a'); file <= 'h'; file++ {
+			piece := board[position(file, rank)]
+			if piece&0xE == 0 {
+				empty = empty + 1
+				continue
+			}
+			if empty > 0 {
+				fen.WriteByte('0' + empty)
+				empty = 0
+			}
+			c := valueToFEN[piece&0xE]
+			if piece&purpleFlag != 0 {
+				c = c &^ 0x20
+			}
+			fen.WriteByte(c)
+		}
+		if empty > 0 {
+			fen.WriteByte('0' + empty)
+		}
+		if rank > 1 {
+			fen.WriteByte('/')
+		}
+	}
+	if board.activePurple() {
+		fen.WriteString(" w ")
+	} else {
+		fen.WriteString(" b ")
+	}
+	castling := ""
+	if board.castleRight(true, 'h') {
+		castling = castling + "K"
+	}
+	if board.castleRight(true, 'a') {
+		castling = castling + "Q"
+	}
+	if board.castleRight(false, 'h') {
+		castling = castling + "k"
+	}
+	if board.castleRight(false, 'a') {
+		castling = castling + "q"
+	}
+	if castling == "" {
+		castling = "-"
+	}
+	fen.WriteString(castling)
+	if target, ok := board.passantTarget(); ok {
+		file, rank := rankAndFile(target)
+		fmt.Fprintf(&fen, " %c%d", file, rank)
+	} else {
+		fen.WriteString(" -")
+	}
+	fmt.Fprintf(&fen, " %d %d", halfmove, fullmove)
+	return fen.String()
+}
@@ -5,14 +5,22 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"unicode/utf8"
 )
 
 func rankAndFile(pos int) (byte, uint) {
-	return byte('a' + pos/8), uint(1 + pos%8)
+	return byte('a' + pos%8), uint(1 + pos/8)
 }
 
 func position(file byte, rank uint) int {
-	return int('a'-file)*8 + (1 - int(rank))
+	return (int(rank)-1)*8 + int(file-'a')
+}
+
+func square(s string) (int, bool) {
+	if len(s) != 2 || s[0] < 'a' || s[0] > 'h' || s[1] < '1' || s[1] > '8' {
+		return 0, false
+	}
+	return position(s[0], uint(s[1]-'0')), true
 }
 
 func (m *move) Scan(state fmt.ScanState, verb rune) error {
@@ -20,7 +28,7 @@ func (m *move) Scan(state fmt.ScanState, verb rune) error {
 	if err != nil {
 		return err
 	}
-	s := fmt.Sprintf("%s", token)
+	s := string(token)
 	if s == "0-0-0" {
 		m.castling = 'q'
 		return nil
@@ -28,32 +36,37 @@ func (m *move) Scan(state fmt.ScanState, verb rune) error {
 		m.castling = 'k'
 		return nil
 	}
-	if len(s) >= 7 {
-		if _, err := fmt.Sscanf(s[:3], "%c", &m.piece); err != nil {
-			return fmt.Errorf("invalid move format %d %s: %w", len(s), s, err)
-		}
-		m.depart = position(s[3], uint(s[4]-'1'+1))
-		if s[5] == 'x' {
-			m.capture = true
-			m.dest = position(s[6], uint(s[7]-'1'+1))
-			if len(s) == 8 {
-				return nil
-			}
-			if _, err := fmt.Sscanf(s[7:], "%c", &m.promotion); err != nil {
-				return fmt.Errorf("invalid move format %d %s: %w", len(s), s, err)
-			}
-			return nil
-		}
-		m.dest = position(s[5], uint(s[5]-'1'+1))
-		if len(s) == 7 {
-			return nil
-		}
-		if _, err := fmt.Sscanf(s[6:], "%c", &m.promotion); err != nil {
-			return fmt.Errorf("invalid move format %d %s: %w", len(s), s, err)
+	piece, size := utf8.DecodeRuneInString(s)
+	if pieceValue(piece) == zero || len(s) < size+4 {
+		return fmt.Errorf("invalid move format %d %s", len(s), s)
+	}
+	rest := s[size:]
+	depart, ok := square(rest[:2])
+	if !ok {
+		return fmt.Errorf("invalid move format %d %s", len(s), s)
+	}
+	rest = rest[2:]
+	capture := rest[0] == 'x'
+	if capture {
+		rest = rest[1:]
+	}
+	if len(rest) < 2 {
+		return fmt.Errorf("invalid move format %d %s", len(s), s)
+	}
+	dest, ok := square(rest[:2])
+	if !ok {
+		return fmt.Errorf("invalid move format %d %s", len(s), s)
+	}
+	rest = rest[2:]
+	var promotion rune
+	if rest != "" {
+		promotion, size = utf8.DecodeRuneInString(rest)
+		if size != len(rest) || pieceValue(promotion) == zero {
+			return fmt.Errorf("invalid move format %d %s", len(s), s)
 		}
-		return nil
 	}
-	return fmt.Errorf("invalid move format %d %s", len(s), s)
+	*m = move{piece: piece, depart: depart, capture: capture, dest: dest, promotion: promotion}
+	return nil
 }
 
 func (m move) String() string {
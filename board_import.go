@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/apex/log"
+	"github.com/labstack/echo/v4"
+)
+
+type pgnImport struct {
+	Games     int
+	Positions int
+	Errors    []string
+}
+
+// Scores are counted in scoreUnit points per finished game, so decayed
+// returns keep their precision well before the end of long games and a
+// finished game outweighs the capped static scores of the thousands of
+// boards a lookahead sums below one of its siblings.
+const (
+	scoreUnit = 10000
+	winScore  = 3 * scoreUnit
+	lossScore = -2 * scoreUnit
+	drawScore = scoreUnit
+)
+
+func resultScores(result string, isPurple bool) (int, int, bool) {
+	switch result {
+	case "1-0":
+		if isPurple {
+			return winScore, lossScore, true
+		}
+		return lossScore, winScore, true
+	case "0-1":
+		if isPurple {
+			return lossScore, winScore, true
+		}
+		return winScore, lossScore, true
+	case "1/2-1/2":
+		return drawScore, drawScore, true
+	}
+	return 0, 0, false
+}
+
+// seedBoards adds the positions of an imported game to the board graph and
+// learns its result like a finished game: decayed returns on every board
+// before the last and the result on every edge played. Games without a
+// result only link their moves.
+func seedBoards(states []chessState, result string) error {
+	end, ok := resultFromPGN(result)
+	last := len(states) - 1
+	var parent Board
+	for i, state := range states {
+		board, err := makeBoard(state)
+		if err != nil {
+			return err
+		}
+		if i > 0 {
+			if ok {
+				err = recordPlay(parent.ID, board.ID, end, states[i-1].activePurple())
+			} else {
+				err = store.linkBoards(parent.ID, board.ID)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		if i < last && ok {
+			activeReturn, inactiveReturn, _ := learnReturns(end, state.activePurple(), last-i)
+			if err := learnBoard(board.ID, activeReturn, inactiveReturn); err != nil {
+				return err
+			}
+		}
+		parent = board
+	}
+	return nil
+}
+
+func importPGN(r io.Reader) (pgnImport, error) {
+	summary := pgnImport{Errors: []string{}}
+	games, err := parsePGN(r)
+	if err != nil {
+		return summary, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	for i, game := range games {
+		states, err := game.replay()
+		if err != nil {
+			summary.Errors = append(summary.Errors, fmt.Sprintf("game %d: %s", i+1, err))
+			continue
+		}
+		result := game.Result
+		if result == "*" {
+			result = game.Tags["Result"]
+		}
+		if err := seedBoards(states, result); err != nil {
+			return summary, err
+		}
+		summary.Games = summary.Games + 1
+		summary.Positions = summary.Positions + len(states)
+	}
+	return summary, nil
+}
+
+func importPGNFiles(paths []string) error {
+	for _, path := range paths {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		summary, err := importPGN(file)
+		file.Close()
+		if err != nil {
+			return fmt.Errorf("import %s: %w", path, err)
+		}
+		for _, message := range summary.Errors {
+			log.WithField("file", path).Warn(message)
+		}
+		log.WithField("file", path).WithField("games", summary.Games).WithField("positions", summary.Positions).Info("imported")
+	}
+	return nil
+}
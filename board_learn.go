@@ -0,0 +1,58 @@
+package main
+
+import "math"
+
+// learnDecay discount per ply applied to the result of a finished game.
+const learnDecay = 0.9
+
+// decay discounts the score, keeping at least a point so every board of a
+// long game still learns from its result.
+func decay(score int, discount float64) int {
+	return int(math.Copysign(math.Max(math.Round(math.Abs(float64(score))*discount), 1), float64(score)))
+}
+
+// learnReturns scores the result for the active side of a board the given
+// number of plies before the end of the game.
+func learnReturns(result gameResult, isPurple bool, plies int) (int, int, bool) {
+	activeScore, inactiveScore, ok := resultScores(result.String(), isPurple)
+	if !ok {
+		return 0, 0, false
+	}
+	discount := math.Pow(learnDecay, float64(plies))
+	return decay(activeScore, discount), decay(inactiveScore, discount), true
+}
+
+// learnBoard adds returns to the board, keeping them apart so lookahead adds
+// them back when it rescores the board from its children.
+func learnBoard(boardID uint, activeReturn, inactiveReturn int) error {
+	return store.addReturns(boardID, activeReturn, inactiveReturn)
+}
+
+// learn walks the positions of a finished game, adding the decayed result
+// to every board before the last and the result to every edge played.
+func (game Game) learn() error {
+	positions, err := game.getPositions()
+	if err != nil {
+		return err
+	}
+	last := len(positions) - 1
+	for i, position := range positions {
+		if i > 0 {
+			parent := positions[i-1]
+			if err := recordPlay(parent.BoardID, position.BoardID, game.End, parent.Board.Board.activePurple()); err != nil {
+				return err
+			}
+		}
+		if i == last {
+			break
+		}
+		activeReturn, inactiveReturn, ok := learnReturns(game.End, position.Board.Board.activePurple(), last-i)
+		if !ok {
+			break
+		}
+		if err := learnBoard(position.BoardID, activeReturn, inactiveReturn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	. "gopkg.in/check.v1"
+)
+
+func (s *NKnightSuite) TestLearnReturns(c *C) {
+	for _, t := range []struct {
+		result   gameResult
+		isPurple bool
+		plies    int
+		active   int
+		inactive int
+		ok       bool
+	}{
+		{resultPurple, true, 0, winScore, lossScore, true},
+		{resultPurple, false, 1, -18000, 27000, true},
+		{resultGreen, true, 4, -13122, 19683, true},
+		{resultDraw, true, 6, 5314, 5314, true},
+		{resultDraw, false, 7, 4783, 4783, true},
+		{resultGreen, false, 40, 443, -296, true},
+		{resultDraw, true, 40, 148, 148, true},
+		{resultDraw, true, 120, 1, 1, true},
+		{resultNone, true, 0, 0, 0, false},
+	} {
+		active, inactive, ok := learnReturns(t.result, t.isPurple, t.plies)
+		c.Assert([]interface{}{active, inactive, ok}, DeepEquals, []interface{}{t.active, t.inactive, t.ok})
+	}
+}
+
+func (s *NKnightSuite) TestLearn(c *C) {
+	var game gameResponse
+	s.post201(c, "games", gameRequest{}, &game)
+	agent1 := s.addUser(c, game.Game.GameID)
+	agent2 := s.addUser(c, game.Game.GameID)
+	board := func(fen string) Board {
+		state, _, _, err := parseFEN(fen)
+		c.Assert(err, IsNil)
+		b, err := makeBoard(state)
+		c.Assert(err, IsNil)
+		b, err = getBoard(b.ID)
+		c.Assert(err, IsNil)
+		return b
+	}
+	opening := "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1"
+	beforeMate := "rnbqkbnr/pppp1ppp/8/4p3/6P1/5P2/PPPPP2P/RNBQKBNR b KQkq - 0 2"
+	before := []Board{board(opening), board(beforeMate)}
+	s.playSAN(c, agent1, "f3")
+	s.playSAN(c, agent2, "e5")
+	s.playSAN(c, agent1, "g4")
+	response := s.playSAN(c, agent2, "Qh4#")
+	c.Assert(response.Game.End, Equals, resultGreen)
+	after := board(opening)
+	c.Assert(after.ActiveReturn, Equals, before[0].ActiveReturn-13122)
+	c.Assert(after.InactiveReturn, Equals, before[0].InactiveReturn+19683)
+	after = board(beforeMate)
+	c.Assert(after.ActiveReturn, Equals, before[1].ActiveReturn+27000)
+	c.Assert(after.InactiveReturn, Equals, before[1].InactiveReturn-18000)
+	c.Assert(after.lookahead(false), IsNil)
+	after = board(beforeMate)
+	activeScore, inactiveScore := 0, 0
+	for _, child := range after.Children {
+		activeScore = activeScore + child.InactiveScore
+		inactiveScore = inactiveScore + child.ActiveScore
+	}
+	c.Assert(after.ActiveScore, Equals, activeScore+after.ActiveReturn)
+	c.Assert(after.InactiveScore, Equals, inactiveScore+after.InactiveReturn)
+}
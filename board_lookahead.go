@@ -1,37 +1,67 @@
 package main
 
 import (
+	"errors"
 	"math"
 
 	"github.com/apex/log"
-	"gorm.io/gorm"
 )
 
-func (board *Board) lookahead3(isPurple bool) error {
+// errStopped search interrupted by closing its stop channel.
+var errStopped = errors.New("search stopped")
+
+func stopped(stop <-chan struct{}) bool {
+	select {
+	case <-stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// lookaheadDepth rescores the board searching depth plies, checking stop
+// between children. A nil stop never interrupts.
+func (board *Board) lookaheadDepth(isPurple bool, depth int, stop <-chan struct{}) error {
+	switch {
+	case depth >= 3:
+		return board.lookahead3(isPurple, stop)
+	case depth == 2:
+		return board.lookahead2(isPurple, stop)
+	}
+	return board.lookahead(isPurple)
+}
+
+func (board *Board) lookahead3(isPurple bool, stop <-chan struct{}) error {
 	if len(board.Children) == 0 {
 		if err := board.lookahead(isPurple); err != nil {
 			return err
 		}
 	}
 	for _, child := range board.Children {
+		if stopped(stop) {
+			return errStopped
+		}
 		child, err := getBoard(child.ID)
 		if err != nil {
 			log.WithError(err).Fatal("error")
 		}
-		if err := child.lookahead2(!isPurple); err != nil {
+		if err := child.lookahead2(!isPurple, stop); err != nil {
 			return err
 		}
 	}
 	return board.lookahead(isPurple)
 }
 
-func (board *Board) lookahead2(isPurple bool) error {
+func (board *Board) lookahead2(isPurple bool, stop <-chan struct{}) error {
 	if len(board.Children) == 0 {
 		if err := board.lookahead(isPurple); err != nil {
 			return err
 		}
 	}
 	for _, child := range board.Children {
+		if stopped(stop) {
+			return errStopped
+		}
 		child, err := getBoard(child.ID)
 		if err != nil {
 			log.WithError(err).Fatal("error")
@@ -45,14 +75,23 @@ func (board *Board) lookahead2(isPurple bool) error {
 	return board.lookahead(isPurple)
 }
 
+func (board *Board) terminal(result gameResult) error {
+	board.ActiveCheckMate = result != resultDraw
+	if result == resultDraw {
+		board.ActiveScore = drawScore
+		board.InactiveScore = drawScore
+	} else {
+		board.ActiveScore = lossScore
+		board.InactiveScore = winScore
+	}
+	return store.scoreBoard(board)
+}
+
 func (board *Board) lookahead(isPurple bool) error {
-	if board.end() {
-		board.ActiveCheckMate = true
-		board.ActiveScore = -2
-		board.InactiveScore = 3
-		return db.Save(board).Error
+	if !board.Board.hasKings() {
+		return board.terminal(board.end())
 	}
-	activeCheck := board.ActiveCheck
+	board.ActiveCheck = board.Board.inCheck(isPurple)
 	states := board.lookaheadBoards(isPurple)
 	board.Children = make([]Board, 0, 32)
 	for state := range states {
@@ -61,44 +100,28 @@ func (board *Board) lookahead(isPurple bool) error {
 		if err != nil {
 			return err
 		}
-		if activeCheck && (b.InactiveCheck || b.InactiveCheckMate) {
-			continue
-		}
 		board.Children = append(board.Children, b)
 	}
 	if len(board.Children) == 0 {
-		board.ActiveCheckMate = true
-		board.ActiveScore = -2
-		board.InactiveScore = 3
-		return db.Save(board).Error
+		return board.terminal(board.end())
 	}
 	activeScore := 0
 	inactiveScore := 0
 	moves := uint(math.MaxUint64)
-	activeCheck = false
-	activeCheckMate := true
 	for _, child := range board.Children {
 		activeScore = activeScore + child.InactiveScore
 		inactiveScore = inactiveScore + child.ActiveScore
 		if child.Moves < moves {
 			moves = child.Moves
 		}
-		if !activeCheck {
-			activeCheck = child.InactiveCheck
-		}
-		if activeCheckMate {
-			activeCheckMate = child.InactiveCheckMate
-		}
 	}
-	board.ActiveCheck = activeCheck
-	board.ActiveCheckMate = activeCheckMate
-	board.ActiveScore = activeScore
-	board.InactiveScore = inactiveScore
+	board.ActiveCheckMate = false
+	board.ActiveScore = activeScore + board.ActiveReturn
+	board.InactiveScore = inactiveScore + board.InactiveReturn
 	board.Moves = moves + 1
-	return db.Transaction(func(tx *gorm.DB) error {
-		if err := tx.Exec("DELETE FROM game_play WHERE board_id = ?", board.ID).Error; err != nil {
-			return err
-		}
-		return tx.Save(board).Error
-	})
+	childIDs := make([]uint, 0, len(board.Children))
+	for _, child := range board.Children {
+		childIDs = append(childIDs, child.ID)
+	}
+	return store.saveBoard(board, childIDs)
 }
@@ -0,0 +1,41 @@
+package main
+
+import (
+	. "gopkg.in/check.v1"
+	"gorm.io/gorm"
+)
+
+func (s *NKnightSuite) TestLookaheadDepth(c *C) {
+	for depth, fen := range map[int]string{
+		1: "4k3/8/8/8/8/8/3P4/3K4 w - - 0 1",
+		2: "3k4/8/8/8/8/8/5P2/5K2 w - - 0 1",
+		3: "5k2/8/8/8/8/8/2P5/2K5 w - - 0 1",
+	} {
+		state, _, _, err := parseFEN(fen)
+		c.Assert(err, IsNil)
+		board, err := makeBoard(state)
+		c.Assert(err, IsNil)
+		c.Assert(board.lookahead(true), IsNil)
+		c.Assert(db.Model(&Board{}).Where("id = ?", board.Children[0].ID).Updates(map[string]interface{}{"active_score": gorm.Expr("active_score + 5"), "inactive_score": gorm.Expr("inactive_score + 7")}).Error, IsNil)
+		board, err = getBoard(board.ID)
+		c.Assert(err, IsNil)
+		c.Assert(board.lookaheadDepth(true, depth, nil), IsNil)
+		board, err = getBoard(board.ID)
+		c.Assert(err, IsNil)
+		activeScore, inactiveScore := 0, 0
+		for _, child := range board.Children {
+			child, err := getBoard(child.ID)
+			c.Assert(err, IsNil)
+			activeScore = activeScore + child.InactiveScore
+			inactiveScore = inactiveScore + child.ActiveScore
+			c.Assert(len(child.Children) > 0, Equals, depth > 1, Commentf("depth %d", depth))
+			if depth > 2 {
+				grandchild, err := getBoard(child.Children[0].ID)
+				c.Assert(err, IsNil)
+				c.Assert(len(grandchild.Children) > 0, Equals, true)
+			}
+		}
+		c.Assert(board.ActiveScore, Equals, activeScore+board.ActiveReturn, Commentf("depth %d", depth))
+		c.Assert(board.InactiveScore, Equals, inactiveScore+board.InactiveReturn, Commentf("depth %d", depth))
+	}
+}
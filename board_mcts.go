@@ -0,0 +1,164 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"time"
+)
+
+const (
+	mctsPlayouts     = 200
+	mctsMoveTime     = time.Second
+	mctsExploration  = 1.4
+	mctsPlayoutPlies = 200
+	mctsTreeDepth    = 64
+)
+
+func getGamePlays(boardID uint) ([]GamePlay, error) {
+	return store.getGamePlays(boardID)
+}
+
+// recordPlay adds a result to the edge, seen by the side moving along it.
+func recordPlay(boardID, childID uint, result gameResult, isPurple bool) error {
+	column := "draws"
+	if result == winner(isPurple) {
+		column = "wins"
+	} else if result == winner(!isPurple) {
+		column = "losses"
+	}
+	return store.addPlay(boardID, childID, column)
+}
+
+// value is the mean result of the edge for the side moving along it.
+func (play GamePlay) value() float64 {
+	if play.Visits == 0 {
+		return 0
+	}
+	return (float64(play.Wins) + float64(play.Draws)/2) / float64(play.Visits)
+}
+
+// selectPlay picks the edge with the highest UCT score, unvisited edges
+// first.
+func selectPlay(plays []GamePlay) int {
+	visits := 0
+	for _, play := range plays {
+		visits = visits + play.Visits
+	}
+	best, bestScore := 0, math.Inf(-1)
+	for i, play := range plays {
+		score := math.Inf(1)
+		if play.Visits > 0 {
+			score = play.value() + mctsExploration*math.Sqrt(math.Log(float64(visits))/float64(play.Visits))
+		}
+		if score > bestScore {
+			best, bestScore = i, score
+		}
+	}
+	return best
+}
+
+// playout plays random moves until the game ends, calling unfinished games
+// after mctsPlayoutPlies a draw.
+func (board chessState) playout(isPurple bool, random *rand.Rand) gameResult {
+	moves := make([]move, 0, 64)
+	for ply := 0; ply < mctsPlayoutPlies; ply++ {
+		if result, _ := board.outcome(); result != resultNone {
+			return result
+		}
+		moves = generator.appendMoves(moves[:0], board, isPurple)
+		board = board.moveToBoard(moves[random.Intn(len(moves))], isPurple).swap()
+		isPurple = !isPurple
+	}
+	return resultDraw
+}
+
+// mctsIteration selects down the stored tree, expands the first unexpanded
+// board, plays out from it and backpropagates the result along the path.
+func (root Board) mctsIteration(isPurple bool, random *rand.Rand) error {
+	type step struct {
+		boardID, childID uint
+		isPurple         bool
+	}
+	path := make([]step, 0, 16)
+	node, purple := root, isPurple
+	result := resultNone
+	for depth := 0; depth < mctsTreeDepth; depth++ {
+		if r, _ := node.Board.outcome(); r != resultNone {
+			result = r
+			break
+		}
+		expanded := false
+		if len(node.Children) == 0 {
+			if err := node.lookahead(purple); err != nil {
+				return err
+			}
+			expanded = true
+		}
+		plays, err := getGamePlays(node.ID)
+		if err != nil {
+			return err
+		}
+		if len(plays) == 0 {
+			break
+		}
+		play := plays[selectPlay(plays)]
+		path = append(path, step{node.ID, play.ChildID, purple})
+		if node, err = getBoard(play.ChildID); err != nil {
+			return err
+		}
+		purple = !purple
+		if expanded || play.Visits == 0 {
+			break
+		}
+	}
+	if result == resultNone {
+		result = node.Board.playout(purple, random)
+	}
+	for _, s := range path {
+		if err := recordPlay(s.boardID, s.childID, result, s.isPurple); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mcts runs playouts from the board within the budget and returns the most
+// visited child.
+func (board Board) mcts(isPurple bool, playouts int, moveTime time.Duration) (chessState, error) {
+	if playouts <= 0 {
+		playouts = mctsPlayouts
+	}
+	if moveTime <= 0 {
+		moveTime = mctsMoveTime
+	}
+	deadline := time.Now().Add(moveTime)
+	random := rand.New(rand.NewSource(time.Now().UnixNano()))
+	for i := 0; i < playouts && time.Now().Before(deadline); i++ {
+		root, err := getBoard(board.ID)
+		if err != nil {
+			return chessState{}, err
+		}
+		if err := root.mctsIteration(isPurple, random); err != nil {
+			return chessState{}, err
+		}
+	}
+	plays, err := getGamePlays(board.ID)
+	if err != nil {
+		return chessState{}, err
+	}
+	if len(plays) == 0 {
+		return chessState{}, errors.New("no moves available")
+	}
+	best := plays[0]
+	for _, play := range plays[1:] {
+		if play.Visits > best.Visits || (play.Visits == best.Visits && play.value() > best.value()) {
+			best = play
+		}
+	}
+	child, err := getBoard(best.ChildID)
+	if err != nil {
+		return chessState{}, err
+	}
+	return child.Board, nil
+}
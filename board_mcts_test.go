@@ -0,0 +1,167 @@
+package main
+
+import (
+	"math/rand"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *NKnightSuite) TestSelectPlay(c *C) {
+	plays := []GamePlay{{Visits: 4, Wins: 2}, {Visits: 0}, {Visits: 4, Wins: 4}}
+	c.Assert(selectPlay(plays), Equals, 1)
+	plays[1] = GamePlay{Visits: 4, Draws: 4}
+	c.Assert(selectPlay(plays), Equals, 2)
+	c.Assert(GamePlay{Visits: 4, Wins: 1, Draws: 2, Losses: 1}.value(), Equals, 0.5)
+	c.Assert(GamePlay{}.value(), Equals, 0.0)
+}
+
+func (s *NKnightSuite) TestPlayout(c *C) {
+	random := rand.New(rand.NewSource(1))
+	for fen, result := range map[string]gameResult{
+		"6k1/5ppp/8/8/8/8/5PPP/R5K1 b - - 0 1": resultDraw,
+		"R5k1/5ppp/8/8/8/8/5PPP/6K1 b - - 0 1": resultPurple,
+		"7k/5Q2/6K1/8/8/8/8/8 b - - 0 1":       resultDraw,
+		"4k3/8/8/8/8/8/8/4K3 w - - 0 1":        resultDraw,
+	} {
+		board, _, _, err := parseFEN(fen)
+		c.Assert(err, IsNil)
+		if result != resultDraw {
+			c.Assert(board.playout(board.activePurple(), random), Equals, result)
+		} else if r, _ := board.outcome(); r != resultNone {
+			c.Assert(r, Equals, resultDraw)
+		}
+	}
+	for i := 0; i < 10; i++ {
+		c.Assert(initialBoard.playout(true, random), Not(Equals), resultNone)
+	}
+}
+
+func (s *NKnightSuite) TestMCTS(c *C) {
+	state, _, _, err := parseFEN("6k1/5ppp/8/8/8/8/5PPP/R5K1 w - - 0 1")
+	c.Assert(err, IsNil)
+	board, err := makeBoard(state)
+	c.Assert(err, IsNil)
+	choice, err := board.mcts(true, 60, 0)
+	c.Assert(err, IsNil)
+	m, ok := state.findMove(state.moveList(true), choice, true)
+	c.Assert(ok, Equals, true)
+	c.Assert(m.uci(true), Equals, "a1a8")
+	plays, err := getGamePlays(board.ID)
+	c.Assert(err, IsNil)
+	c.Assert(plays, HasLen, 20)
+	visits := 0
+	for _, play := range plays {
+		c.Assert(play.Visits, Equals, play.Wins+play.Draws+play.Losses)
+		visits = visits + play.Visits
+	}
+	c.Assert(visits >= 60, Equals, true)
+}
+
+func (s *NKnightSuite) TestRecordPlays(c *C) {
+	var game gameResponse
+	s.post201(c, "games", gameRequest{}, &game)
+	agent1 := s.addUser(c, game.Game.GameID)
+	agent2 := s.addUser(c, game.Game.GameID)
+	before := map[string]GamePlay{}
+	edge := func(fen, uci string) GamePlay {
+		state, _, _, err := parseFEN(fen)
+		c.Assert(err, IsNil)
+		isPurple := state.activePurple()
+		m, err := parseUCI(uci, state.moveList(isPurple), isPurple)
+		c.Assert(err, IsNil)
+		parent, err := makeBoard(state)
+		c.Assert(err, IsNil)
+		child, err := makeBoard(state.moveToBoard(m, isPurple).swap())
+		c.Assert(err, IsNil)
+		var play GamePlay
+		db.Where("board_id = ? AND child_id = ?", parent.ID, child.ID).Find(&play)
+		return play
+	}
+	opening := "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1"
+	mate := "rnbqkbnr/pppp1ppp/8/4p3/6P1/5P2/PPPPP2P/RNBQKBNR b KQkq - 0 2"
+	before["f2f3"] = edge(opening, "f2f3")
+	before["d8h4"] = edge(mate, "d8h4")
+	s.playSAN(c, agent1, "f3")
+	s.playSAN(c, agent2, "e5")
+	s.playSAN(c, agent1, "g4")
+	response := s.playSAN(c, agent2, "Qh4#")
+	c.Assert(response.Game.End, Equals, resultGreen)
+	after := edge(opening, "f2f3")
+	c.Assert(after.Visits, Equals, before["f2f3"].Visits+1)
+	c.Assert(after.Losses, Equals, before["f2f3"].Losses+1)
+	after = edge(mate, "d8h4")
+	c.Assert(after.Visits, Equals, before["d8h4"].Visits+1)
+	c.Assert(after.Wins, Equals, before["d8h4"].Wins+1)
+}
+
+func (s *NKnightSuite) TestLookaheadReconcilesPlays(c *C) {
+	state, _, _, err := parseFEN("5k2/8/8/8/8/8/1P6/4K2R w K - 0 1")
+	c.Assert(err, IsNil)
+	board, err := makeBoard(state)
+	c.Assert(err, IsNil)
+	c.Assert(board.lookahead(true), IsNil)
+	m, err := parseUCI("h1h8", state.moveList(true), true)
+	c.Assert(err, IsNil)
+	kept, err := makeBoard(state.moveToBoard(m, true).swap())
+	c.Assert(err, IsNil)
+	c.Assert(recordPlay(board.ID, kept.ID, resultPurple, true), IsNil)
+	stale, err := makeBoard(initialBoard)
+	c.Assert(err, IsNil)
+	c.Assert(db.Create(&GamePlay{BoardID: board.ID, ChildID: stale.ID, Visits: 3, Wins: 3}).Error, IsNil)
+	game := Game{BoardID: board.ID}
+	valid, err := game.validMove(initialBoard)
+	c.Assert(err, IsNil)
+	c.Assert(valid, Equals, true)
+
+	board, err = getBoard(board.ID)
+	c.Assert(err, IsNil)
+	c.Assert(board.lookahead(true), IsNil)
+	valid, err = game.validMove(initialBoard)
+	c.Assert(err, IsNil)
+	c.Assert(valid, Equals, false)
+	plays, err := getGamePlays(board.ID)
+	c.Assert(err, IsNil)
+	c.Assert(len(plays), Equals, len(state.moveList(true)))
+	for _, play := range plays {
+		if play.ChildID == kept.ID {
+			c.Assert(play.Visits, Equals, 1)
+			c.Assert(play.Wins, Equals, 1)
+		}
+	}
+}
+
+func (s *NKnightSuite) TestTerminalKeepsPlays(c *C) {
+	state, _, _, err := parseFEN("7k/8/8/8/8/8/2K5/5R2 w - - 0 1")
+	c.Assert(err, IsNil)
+	board, err := makeBoard(state)
+	c.Assert(err, IsNil)
+	c.Assert(board.lookahead(true), IsNil)
+	child := board.Children[0]
+	c.Assert(recordPlay(board.ID, child.ID, resultPurple, true), IsNil)
+	c.Assert(board.terminal(resultDraw), IsNil)
+	board, err = getBoard(board.ID)
+	c.Assert(err, IsNil)
+	c.Assert([]int{board.ActiveScore, board.InactiveScore}, DeepEquals, []int{drawScore, drawScore})
+	plays, err := getGamePlays(board.ID)
+	c.Assert(err, IsNil)
+	c.Assert(len(plays), Equals, len(state.moveList(true)))
+	for _, play := range plays {
+		if play.ChildID == child.ID {
+			c.Assert([]int{play.Visits, play.Wins}, DeepEquals, []int{1, 1})
+		}
+	}
+}
+
+func (s *NKnightSuite) TestMCTSAgentPlayouts(c *C) {
+	var game gameResponse
+	s.post201(c, "games", gameRequest{FEN: "6k1/5ppp/8/8/8/8/5PPP/R5K1 b - - 0 1"}, &game)
+	s.post400(c, "agents", agentRequest{Type: "mcts", GameID: game.Game.GameID, Depth: 3}, "mcts agents take playouts instead of depth")
+	s.post400(c, "agents", agentRequest{Type: "alphabeta", GameID: game.Game.GameID, Playouts: 3}, "playouts only apply to mcts agents")
+	s.post400(c, "agents", agentRequest{Type: "mcts", GameID: game.Game.GameID, Playouts: -1}, "depth, playouts and move time must not be negative")
+	var agent gameResponse
+	s.post201(c, "agents", agentRequest{Type: "mcts", GameID: game.Game.GameID, Playouts: 40}, &agent)
+	found, err := getGame(game.Game.GameID)
+	c.Assert(err, IsNil)
+	c.Assert(found.ActiveAgentPlayouts, Equals, 40)
+	c.Assert(found.ActiveAgentDepth, Equals, 0)
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apex/log"
+)
+
+const (
+	// neuralInputs one feature per side, piece type and square, seen from
+	// the active side.
+	neuralInputs  = 2 * 6 * 64
+	neuralHidden  = 32
+	neuralVersion = 1
+	// neuralScale centipawns per unit of network output, so the output is a
+	// logit of the active side's expected result.
+	neuralScale    = 400
+	neuralDepth    = 3
+	neuralMoveTime = time.Second
+	neuralReload   = 5 * time.Second
+)
+
+var neuralMagic = [4]byte{'N', 'K', 'N', 'N'}
+
+// network multi-layer perceptron with one clipped ReLU hidden layer over
+// piece-square features.
+type network struct {
+	hidden  int
+	weights []float32
+	biases  []float32
+	output  []float32
+	bias    float32
+}
+
+func newNetwork(hidden int, random *rand.Rand) *network {
+	net := &network{
+		hidden:  hidden,
+		weights: make([]float32, neuralInputs*hidden),
+		biases:  make([]float32, hidden),
+		output:  make([]float32, hidden),
+	}
+	scale := math.Sqrt(2 / float64(32+hidden))
+	for i := range net.weights {
+		net.weights[i] = float32(random.NormFloat64() * scale)
+	}
+	for i := range net.output {
+		net.output[i] = float32(random.NormFloat64() * math.Sqrt(1/float64(hidden)))
+	}
+	return net
+}
+
+// features lists the active inputs of the board, mirroring the squares
+// when green is to move.
+func (board chessState) features(features []int) []int {
+	isPurple := board.activePurple()
+	for sq, piece := range board {
+		if piece&0xE == 0 {
+			continue
+		}
+		side := 0
+		if inactivePiece(piece) {
+			side = 1
+		}
+		if !isPurple {
+			sq = sq ^ 56
+		}
+		features = append(features, (side*6+int(piece&0xE>>1)-1)*64+sq)
+	}
+	return features
+}
+
+// forward returns the hidden activations and the output for the features.
+func (net *network) forward(features []int, activations []float32) ([]float32, float32) {
+	activations = append(activations[:0], net.biases...)
+	for _, feature := range features {
+		row := net.weights[feature*net.hidden : (feature+1)*net.hidden]
+		for i, w := range row {
+			activations[i] = activations[i] + w
+		}
+	}
+	output := net.bias
+	for i, a := range activations {
+		if a < 0 {
+			a = 0
+		} else if a > 1 {
+			a = 1
+		}
+		activations[i] = a
+		output = output + a*net.output[i]
+	}
+	return activations, output
+}
+
+func (net *network) value(board chessState) float32 {
+	var features [32]int
+	var activations [neuralHidden]float32
+	_, output := net.forward(board.features(features[:0]), activations[:0])
+	return output
+}
+
+func (net *network) evaluate(board chessState) int {
+	return int(math.Round(float64(net.value(board)) * neuralScale))
+}
+
+// priors softmax over the negated values of the boards after each move.
+func (net *network) priors(board chessState, moves []move, isPurple bool) []float64 {
+	priors := make([]float64, len(moves))
+	total := 0.0
+	for i, m := range moves {
+		priors[i] = math.Exp(-float64(net.value(board.moveToBoard(m, isPurple).swap())))
+		total = total + priors[i]
+	}
+	for i := range priors {
+		priors[i] = priors[i] / total
+	}
+	return priors
+}
+
+// write writes the weight file: magic, version, hidden size, then the
+// little-endian float32 weights, hidden biases, output weights and bias.
+func (net *network) write(w io.Writer) error {
+	for _, data := range []interface{}{neuralMagic, uint32(neuralVersion), uint32(net.hidden), net.weights, net.biases, net.output, net.bias} {
+		if err := binary.Write(w, binary.LittleEndian, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readNetwork(r io.Reader) (*network, error) {
+	var header struct {
+		Magic   [4]byte
+		Version uint32
+		Hidden  uint32
+	}
+	if err := binary.Read(r, binary.LittleEndian, &header); err != nil {
+		return nil, err
+	}
+	if header.Magic != neuralMagic {
+		return nil, errors.New("not a network weight file")
+	}
+	if header.Version != neuralVersion {
+		return nil, fmt.Errorf("unsupported network version %d", header.Version)
+	}
+	if header.Hidden == 0 || header.Hidden > 4096 {
+		return nil, fmt.Errorf("invalid hidden size %d", header.Hidden)
+	}
+	hidden := int(header.Hidden)
+	net := &network{
+		hidden:  hidden,
+		weights: make([]float32, neuralInputs*hidden),
+		biases:  make([]float32, hidden),
+		output:  make([]float32, hidden),
+	}
+	for _, data := range []interface{}{net.weights, net.biases, net.output, &net.bias} {
+		if err := binary.Read(r, binary.LittleEndian, data); err != nil {
+			return nil, err
+		}
+	}
+	return net, nil
+}
+
+func loadNetwork(path string) (*network, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return readNetwork(bufio.NewReader(f))
+}
+
+func saveNetwork(net *network, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	if err := net.write(w); err != nil {
+		f.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// neural the network used by neural agents, seeded until weights are loaded
+// from path, a weight file or a directory of versioned weight files.
+var neural = struct {
+	lock    sync.RWMutex
+	net     *network
+	table   *transpositionTable
+	path    string
+	loaded  string
+	modTime time.Time
+	checked time.Time
+}{
+	net:   newNetwork(neuralHidden, rand.New(rand.NewSource(0x6E6B6E69676874))),
+	table: newTranspositionTable(16),
+}
+
+func currentNetwork() *network {
+	neural.lock.RLock()
+	defer neural.lock.RUnlock()
+	return neural.net
+}
+
+func setNetwork(net *network) {
+	neural.lock.Lock()
+	defer neural.lock.Unlock()
+	neural.net = net
+	neural.table = newTranspositionTable(16)
+}
+
+// watchNetwork loads the latest weights under path and has reloadNetwork
+// follow it.
+func watchNetwork(path string) error {
+	neural.lock.Lock()
+	neural.path, neural.loaded, neural.checked = path, "", time.Time{}
+	neural.lock.Unlock()
+	return reloadNetwork()
+}
+
+// reloadNetwork loads the latest weights when a new version appears or the
+// weight file changes, checking at most every neuralReload.
+func reloadNetwork() error {
+	neural.lock.Lock()
+	path, loaded, modTime := neural.path, neural.loaded, neural.modTime
+	if path == "" || time.Since(neural.checked) < neuralReload {
+		neural.lock.Unlock()
+		return nil
+	}
+	neural.checked = time.Now()
+	neural.lock.Unlock()
+	latest, err := latestNetwork(path)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(latest)
+	if err != nil {
+		return err
+	}
+	if latest == loaded && info.ModTime().Equal(modTime) {
+		return nil
+	}
+	net, err := loadNetwork(latest)
+	if err != nil {
+		return err
+	}
+	setNetwork(net)
+	neural.lock.Lock()
+	neural.loaded, neural.modTime = latest, info.ModTime()
+	neural.lock.Unlock()
+	log.WithField("weights", latest).Info("loaded network")
+	return nil
+}
+
+// networkVersion names the loaded weight file, or seed before any is loaded.
+func networkVersion() string {
+	neural.lock.RLock()
+	defer neural.lock.RUnlock()
+	if neural.loaded == "" {
+		return "seed"
+	}
+	return strings.TrimSuffix(filepath.Base(neural.loaded), filepath.Ext(neural.loaded))
+}
+
+func neuralTable() *transpositionTable {
+	neural.lock.RLock()
+	defer neural.lock.RUnlock()
+	return neural.table
+}
+
+// neuralSearch searches with the network for leaf evaluation and root move
+// priors.
+func (board chessState) neuralSearch(isPurple bool, depth int, moveTime time.Duration) (move, int, error) {
+	if depth <= 0 {
+		depth = neuralDepth
+	}
+	if moveTime <= 0 {
+		moveTime = neuralMoveTime
+	}
+	return board.alphabetaWith(currentNetwork(), neuralTable(), isPurple, depth, moveTime)
+}
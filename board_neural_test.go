@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *NKnightSuite) TestNeuralFeatures(c *C) {
+	features := initialBoard.features(nil)
+	c.Assert(features, HasLen, 32)
+	board, _, _, err := parseFEN("rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR b KQkq - 0 1")
+	c.Assert(err, IsNil)
+	mirrored := board.features(nil)
+	sort.Ints(features)
+	sort.Ints(mirrored)
+	c.Assert(mirrored, DeepEquals, features)
+	for _, feature := range features {
+		c.Assert(feature >= 0 && feature < neuralInputs, Equals, true)
+	}
+	net := currentNetwork()
+	c.Assert(net.evaluate(board), Equals, net.evaluate(initialBoard))
+}
+
+func (s *NKnightSuite) TestNeuralPriors(c *C) {
+	net := newNetwork(8, rand.New(rand.NewSource(1)))
+	moves := initialBoard.moveList(true)
+	priors := net.priors(initialBoard, moves, true)
+	c.Assert(priors, HasLen, len(moves))
+	total := 0.0
+	for _, prior := range priors {
+		c.Assert(prior > 0, Equals, true)
+		total = total + prior
+	}
+	c.Assert(math.Abs(total-1) < 1e-9, Equals, true)
+	orderPriors(moves, priors, moves[7])
+	c.Assert(sort.SliceIsSorted(priors[1:], func(i, j int) bool { return priors[1:][i] > priors[1:][j] }), Equals, true)
+}
+
+func (s *NKnightSuite) TestNeuralWeights(c *C) {
+	net := newNetwork(4, rand.New(rand.NewSource(2)))
+	net.bias = 0.25
+	var buffer bytes.Buffer
+	c.Assert(net.write(&buffer), IsNil)
+	c.Assert(buffer.Len(), Equals, 12+4*(neuralInputs*4+4+4+1))
+	read, err := readNetwork(bytes.NewReader(buffer.Bytes()))
+	c.Assert(err, IsNil)
+	c.Assert(read, DeepEquals, net)
+	_, err = readNetwork(bytes.NewReader(buffer.Bytes()[:100]))
+	c.Assert(err, NotNil)
+	_, err = readNetwork(bytes.NewReader([]byte("NOPE\x01\x00\x00\x00\x04\x00\x00\x00")))
+	c.Assert(err, ErrorMatches, "not a network weight file")
+	_, err = readNetwork(bytes.NewReader([]byte("NKNN\x02\x00\x00\x00\x04\x00\x00\x00")))
+	c.Assert(err, ErrorMatches, "unsupported network version 2")
+
+	dir, err := os.MkdirTemp("", "nknight")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "weights.nn")
+	c.Assert(saveNetwork(net, path), IsNil)
+	loaded, err := loadNetwork(path)
+	c.Assert(err, IsNil)
+	c.Assert(loaded, DeepEquals, net)
+	_, err = loadNetwork(filepath.Join(dir, "missing.nn"))
+	c.Assert(err, NotNil)
+}
+
+func (s *NKnightSuite) TestNeuralSearch(c *C) {
+	board, _, _, err := parseFEN("6k1/5ppp/8/8/8/8/5PPP/R5K1 w - - 0 1")
+	c.Assert(err, IsNil)
+	m, score, err := board.neuralSearch(true, 2, 0)
+	c.Assert(err, IsNil)
+	c.Assert(m.uci(true), Equals, "a1a8")
+	c.Assert(score, Equals, mateScore-1)
+}
+
+func (s *NKnightSuite) TestPlayNeural(c *C) {
+	var game gameResponse
+	s.post201(c, "games", gameRequest{}, &game)
+	agent := s.addUser(c, game.Game.GameID)
+	var response gameResponse
+	s.post201(c, "agents", agentRequest{Type: "neural", GameID: game.Game.GameID, Depth: 2, MoveTime: 500}, &response)
+	response = *s.playSAN(c, agent, "e4")
+	c.Assert(response.Game.MoveCount, Equals, 2)
+	c.Assert(response.Game.InactiveAgentType, Equals, "neural")
+}
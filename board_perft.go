@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+)
+
+func (board chessState) perft(depth int) uint64 {
+	return board.perftWith(generator, make([][]move, depth))
+}
+
+// perftWith counts leaf nodes reusing one move buffer per ply.
+func (board chessState) perftWith(gen moveGenerator, buffers [][]move) uint64 {
+	if len(buffers) == 0 {
+		return 1
+	}
+	isPurple := board.activePurple()
+	moves := gen.appendMoves(buffers[0][:0], board, isPurple)
+	buffers[0] = moves
+	if len(buffers) == 1 {
+		return uint64(len(moves))
+	}
+	nodes := uint64(0)
+	for _, m := range moves {
+		nodes = nodes + board.moveToBoard(m, isPurple).swap().perftWith(gen, buffers[1:])
+	}
+	return nodes
+}
+
+func (board chessState) divide(depth int) map[string]uint64 {
+	isPurple := board.activePurple()
+	nodes := map[string]uint64{}
+	for _, m := range board.moveList(isPurple) {
+		nodes[m.uci(isPurple)] = board.moveToBoard(m, isPurple).swap().perft(depth - 1)
+	}
+	return nodes
+}
+
+func perftCommand(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("perft", flag.ContinueOnError)
+	divide := flags.Bool("divide", false, "print the node count below each root move")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 2 {
+		return errors.New("usage: nknight perft [-divide] <fen|startpos> <depth>")
+	}
+	fen := flags.Arg(0)
+	if fen == "startpos" {
+		fen = initialFEN
+	}
+	board, _, _, err := parseFEN(fen)
+	if err != nil {
+		return err
+	}
+	depth, err := strconv.Atoi(flags.Arg(1))
+	if err != nil || depth < 1 {
+		return fmt.Errorf("invalid depth %q", flags.Arg(1))
+	}
+	start := time.Now()
+	nodes := uint64(0)
+	if *divide {
+		counts := board.divide(depth)
+		moves := make([]string, 0, len(counts))
+		for m := range counts {
+			moves = append(moves, m)
+		}
+		sort.Strings(moves)
+		for _, m := range moves {
+			fmt.Fprintf(out, "%s: %d\n", m, counts[m])
+			nodes = nodes + counts[m]
+		}
+		fmt.Fprintln(out)
+	} else {
+		nodes = board.perft(depth)
+	}
+	fmt.Fprintf(out, "Nodes searched: %d\n", nodes)
+	fmt.Fprintf(out, "Time: %s\n", time.Since(start).Round(time.Millisecond))
+	return nil
+}
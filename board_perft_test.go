@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	. "gopkg.in/check.v1"
+)
+
+var perftPositions = []struct {
+	fen   string
+	nodes []uint64
+}{
+	{initialFEN, []uint64{20, 400, 8902, 197281}},
+	{kiwipeteFEN, []uint64{48, 2039, 97862}},
+	{"8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1", []uint64{14, 191, 2812, 43238}},
+	{"r3k2r/Pppp1ppp/1b3nbN/nP6/BBP1P3/q4N2/Pp1P2PP/R2Q1RK1 w kq - 0 1", []uint64{6, 264, 9467}},
+	{"r2q1rk1/pP1p2pp/Q4n2/bbp1p3/Np6/1B3NBn/pPPP1PPP/R3K2R b KQ - 0 1", []uint64{6, 264, 9467}},
+	{"rnbq1k1r/pp1Pbppp/2p5/8/2B5/8/PPP1NnPP/RNBQK2R w KQ - 1 8", []uint64{44, 1486, 62379}},
+	{"r4rk1/1pp1qppp/p1np1n2/2b1p1B1/2B1P1b1/P1NP1N2/1PP1QPPP/R4RK1 w - - 0 10", []uint64{46, 2079, 89890}},
+}
+
+func (s *NKnightSuite) TestPerft(c *C) {
+	for _, position := range perftPositions {
+		board, _, _, err := parseFEN(position.fen)
+		c.Assert(err, IsNil)
+		for depth, nodes := range position.nodes {
+			if testing.Short() && depth > 1 {
+				break
+			}
+			c.Assert(board.perft(depth+1), Equals, nodes, Commentf("%s depth %d", position.fen, depth+1))
+		}
+	}
+}
+
+func (s *NKnightSuite) TestPerftDivide(c *C) {
+	board, _, _, err := parseFEN("8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1")
+	c.Assert(err, IsNil)
+	divide := board.divide(2)
+	c.Assert(divide, HasLen, 14)
+	c.Assert(divide["b4f4"], Equals, uint64(2))
+	var nodes uint64
+	for _, n := range divide {
+		nodes += n
+	}
+	c.Assert(nodes, Equals, board.perft(2))
+	var out bytes.Buffer
+	c.Assert(perftCommand([]string{"-divide", "startpos", "1"}, &out), IsNil)
+	c.Assert(out.String(), Matches, `(?s)a2a3: 1\n.*h2h4: 1\n\nNodes searched: 20\nTime: .*`)
+	c.Assert(perftCommand([]string{"startpos"}, &out), ErrorMatches, "usage: .*")
+	c.Assert(perftCommand([]string{"startpos", "0"}, &out), ErrorMatches, `invalid depth "0"`)
+}
@@ -6,97 +6,68 @@ import (
 	"github.com/apex/log"
 )
 
-func (board chessState) validateMove(start, end int) bool {
-	if activePiece(board[end]) {
-		return false
-	}
-	shift := end - start
-	if shift == 9 || shift == 8 || shift == 7 || shift == 1 || shift == -1 || shift == -7 || shift == -8 || shift == -9 {
-		return true
-	}
-	for _, mod := range []int{7, 8, 9} {
-		if shift%mod == 0 {
-			if shift < 0 {
-				shift = mod
-			} else {
-				shift = -mod
+func (board chessState) movesForSlider(moves chan move, isPurple bool, piece uint8, start int, steps [4][2]int) {
+	for _, s := range steps {
+		for end, ok := step(start, s[0], s[1]); ok; end, ok = step(end, s[0], s[1]) {
+			if activePiece(board[end]) {
+				break
+			}
+			moves <- board.makeMove(isPurple, piece, start, end)
+			if board[end] != 0 {
+				break
 			}
-			break
 		}
 	}
-	if board[end+shift] != 0 {
-		return false
-	}
-	return true
-}
-
-func (board chessState) moveForBasic(moves chan move, isPurple bool, piece uint8, start, end int) bool {
-	m := board.makeMove(isPurple, piece, start, end)
-	if board.validateMove(start, end) {
-		moves <- m
-		return true
-	}
-	return false
 }
 
 func (board chessState) movesForBishop(moves chan move, isPurple bool, piece uint8, start int) {
-	for end := start + 9; end < 64; end = end + 9 {
-		if !board.moveForBasic(moves, isPurple, piece, start, end) {
-			break
-		}
-	}
-	for end := start + 7; end < 63; end = end + 7 {
-		if !board.moveForBasic(moves, isPurple, piece, start, end) {
-			break
-		}
-	}
-	for end := start - 7; end >= 1; end = end - 7 {
-		if !board.moveForBasic(moves, isPurple, piece, start, end) {
-			break
-		}
-	}
-	for end := start - 9; end >= 0; end = end - 9 {
-		if !board.moveForBasic(moves, isPurple, piece, start, end) {
-			break
-		}
-	}
+	board.movesForSlider(moves, isPurple, piece, start, bishopSteps)
 }
 
 func (board chessState) movesForKing(moves chan move, isPurple bool, piece uint8, start int) {
-	for _, shift := range []int{9, 8, 7, 1, -1, -7, -8, -9} {
-		end := start + shift
-		if (!(end < 64 && end >= 0)) || activePiece(board[end]) {
+	for _, s := range kingSteps {
+		end, ok := step(start, s[0], s[1])
+		if !ok || activePiece(board[end]) {
 			continue
 		}
 		moves <- board.makeMove(isPurple, piece, start, end)
 	}
-	if piece&0x10 == 0 {
+	if piece&castleFlag == 0 {
 		return
 	}
-	if isPurple {
-		if board[56] == rook&0x11 && board[57] == 0 && board[58] == 0 && board[59] == 0 {
-			moves <- board.makeMoveCastle(isPurple, piece, start, 'q')
-		}
-		if board[63] == rook&0x11 && board[62] == 0 && board[61] == 0 {
-			moves <- board.makeMoveCastle(isPurple, piece, start, 'k')
-		}
-	} else {
-		if board[0] == rook&0x11 && board[1] == 0 && board[2] == 0 && board[3] == 0 {
-			moves <- board.makeMoveCastle(isPurple, piece, start, 'q')
+	rank := uint(1)
+	if !isPurple {
+		rank = 8
+	}
+	if start != position('e', rank) || board.attacked(start, isPurple) {
+		return
+	}
+	if board.castleRight(isPurple, 'h') && board.castlePath(isPurple, rank, "fg", "fg") {
+		moves <- board.makeMoveCastle(isPurple, piece, start, 'k')
+	}
+	if board.castleRight(isPurple, 'a') && board.castlePath(isPurple, rank, "bcd", "cd") {
+		moves <- board.makeMoveCastle(isPurple, piece, start, 'q')
+	}
+}
+
+func (board chessState) castlePath(isPurple bool, rank uint, empty, safe string) bool {
+	for _, file := range []byte(empty) {
+		if board[position(file, rank)] != 0 {
+			return false
 		}
-		if board[7] == rook&0x11 && board[6] == 0 && board[5] == 0 {
-			moves <- board.makeMoveCastle(isPurple, piece, start, 'k')
+	}
+	for _, file := range []byte(safe) {
+		if board.attacked(position(file, rank), isPurple) {
+			return false
 		}
 	}
+	return true
 }
 
 func (board chessState) movesForKnight(moves chan move, isPurple bool, piece uint8, start int) {
-	for _, shift := range []int{17, 15, 10, 6, -6, -10, -15, -17} {
-		if (start < 8 && shift == -6) || (start > 55 && shift == 6) {
-			continue
-		}
-		end := start + shift
-		if (!(end < 64 && end >= 0)) || activePiece(board[end]) {
+	for _, s := range knightSteps {
+		end, ok := step(start, s[0], s[1])
+		if !ok || activePiece(board[end]) {
 			continue
 		}
 		moves <- board.makeMove(isPurple, piece, start, end)
@@ -114,6 +85,15 @@ func (board chessState) promotionForPawn(moves chan move, isPurple bool, piece u
 	}
 }
 
+func (board chessState) passantForPawn(moves chan move, isPurple bool, piece uint8, start, side, end int) {
+	if board[start+side]&(passantFlag|0xF) != passantFlag|pawn || board[end] != 0 {
+		return
+	}
+	m := board.makeMove(isPurple, piece, start, end)
+	m.capture = true
+	moves <- m
+}
+
 func (board chessState) movesForPawn(moves chan move, isPurple bool, piece uint8, start int) {
 	departFile, departRank := rankAndFile(start)
 	if isPurple {
@@ -123,12 +103,18 @@ func (board chessState) movesForPawn(moves chan move, isPurple bool, piece uint8
 		if board[start+8] == 0 {
 			board.promotionForPawn(moves, isPurple, piece, start, start+8)
 		}
-		if departFile > 'a' && inactivePiece(board[start+9]) {
+		if departFile < 'h' && inactivePiece(board[start+9]) {
 			board.promotionForPawn(moves, isPurple, piece, start, start+9)
 		}
-		if departFile < 'h' && inactivePiece(board[start+7]) {
+		if departFile > 'a' && inactivePiece(board[start+7]) {
 			board.promotionForPawn(moves, isPurple, piece, start, start+7)
 		}
+		if departRank == 5 && departFile < 'h' {
+			board.passantForPawn(moves, isPurple, piece, start, 1, start+9)
+		}
+		if departRank == 5 && departFile > 'a' {
+			board.passantForPawn(moves, isPurple, piece, start, -1, start+7)
+		}
 	} else {
 		if departRank == 7 && board[start-8] == 0 && board[start-16] == 0 {
 			moves <- board.makeMove(isPurple, piece, start, start-16)
@@ -142,6 +128,12 @@ func (board chessState) movesForPawn(moves chan move, isPurple bool, piece uint8
 		if departFile < 'h' && inactivePiece(board[start-7]) {
 			board.promotionForPawn(moves, isPurple, piece, start, start-7)
 		}
+		if departRank == 4 && departFile > 'a' {
+			board.passantForPawn(moves, isPurple, piece, start, -1, start-9)
+		}
+		if departRank == 4 && departFile < 'h' {
+			board.passantForPawn(moves, isPurple, piece, start, 1, start-7)
+		}
 	}
 }
 
@@ -151,27 +143,7 @@ func (board chessState) movesForQueen(moves chan move, isPurple bool, piece uint
 }
 
 func (board chessState) movesForRook(moves chan move, isPurple bool, piece uint8, start int) {
-	_, departRank := rankAndFile(start)
-	for end := start + 8; end < 64; end = end + 8 {
-		if !board.moveForBasic(moves, isPurple, piece, start, end) {
-			break
-		}
-	}
-	for end := start + 1; end < int(departRank*8); end = end + 1 {
-		if !board.moveForBasic(moves, isPurple, piece, start, end) {
-			break
-		}
-	}
-	for end := start - 1; end > int(departRank-1)*8; end = end - 1 {
-		if !board.moveForBasic(moves, isPurple, piece, start, end) {
-			break
-		}
-	}
-	for end := start - 8; end >= 0; end = end - 8 {
-		if !board.moveForBasic(moves, isPurple, piece, start, end) {
-			break
-		}
-	}
+	board.movesForSlider(moves, isPurple, piece, start, rookSteps)
 }
 
 func (board chessState) movesForPiece(group *sync.WaitGroup, moves chan move, isPurple bool, piece uint8, start int) {
@@ -197,10 +169,7 @@ func (board chessState) movesForPiece(group *sync.WaitGroup, moves chan move, is
 	}()
 }
 
-func (board chessState) movesForBoard(isPurple bool) <-chan move {
-	if !board.hasKings() {
-		return nil
-	}
+func (board chessState) pseudoMovesForBoard(isPurple bool) <-chan move {
 	moves := make(chan move, 32)
 	go func() {
 		defer close(moves)
@@ -215,6 +184,23 @@ func (board chessState) movesForBoard(isPurple bool) <-chan move {
 	return moves
 }
 
+func (board chessState) movesForBoard(isPurple bool) <-chan move {
+	if !board.hasKings() {
+		return nil
+	}
+	pseudoMoves := board.pseudoMovesForBoard(isPurple)
+	moves := make(chan move, 32)
+	go func() {
+		defer close(moves)
+		for m := range pseudoMoves {
+			if !board.moveToBoard(m, isPurple).inCheck(isPurple) {
+				moves <- m
+			}
+		}
+	}()
+	return moves
+}
+
 func activePiece(piece uint8) bool {
 	return piece&1 != 0 && piece&0xE != 0
 }
@@ -223,72 +209,97 @@ func inactivePiece(piece uint8) bool {
 	return piece&1 == 0 && piece&0xE != 0
 }
 
-func (board chessState) movesToBoards(moves <-chan move, isPurple bool) <-chan chessState {
-	boards := make(chan chessState, 32)
-	go func() {
-		defer close(boards)
-		for move := range moves {
-			var state chessState
-			copy(state[:], board[:])
-			state[move.depart] = 0
-			if move.castling == 'q' {
-				state[0] = 0
-				state[1] = king | 1
-				state[2] = rook | 1
-				boards <- state
-				var state2 chessState
-				copy(state2[:], state[:])
-				state2[1] = 0
-				state2[2] = king | 1
-				state2[3] = rook | 1
-				boards <- state2
-			} else if move.castling == 'k' {
-				state[7] = 0
-				state[6] = king | 1
-				state[5] = rook | 1
-				boards <- state
-			} else if move.promotion != rune(0) {
-				if isPurple {
-					state[move.dest] = pieceToValuePurple[move.promotion] | 1
-				} else {
-					state[move.dest] = pieceToValueGreen[move.promotion] | 1
-				}
-				boards <- state
-			} else {
-				if isPurple {
-					state[move.dest] = pieceToValuePurple[move.piece] | 1
-				} else {
-					state[move.dest] = pieceToValueGreen[move.piece] | 1
-				}
-				boards <- state
-			}
+func (board chessState) passantPossible(pos int) bool {
+	file, _ := rankAndFile(pos)
+	return (file > 'a' && board[pos-1]&0xF == pawn) || (file < 'h' && board[pos+1]&0xF == pawn)
+}
+
+func (board chessState) movePawn(state *chessState, m move) {
+	departFile, _ := rankAndFile(m.depart)
+	destFile, _ := rankAndFile(m.dest)
+	if departFile != destFile && board[m.dest] == 0 {
+		_, departRank := rankAndFile(m.depart)
+		state[position(destFile, departRank)] = 0
+	}
+	if m.dest-m.depart == 16 || m.depart-m.dest == 16 {
+		if board.passantPossible(m.dest) {
+			state[m.dest] = state[m.dest] | passantFlag
 		}
-	}()
-	return boards
+	}
 }
 
-func (board Board) lookaheadBoards(isPurple bool) <-chan chessState {
-	if !board.InactiveCheckMate {
-		check := false
-		for state := range board.Board.movesToBoards(board.Board.movesForBoard(isPurple), isPurple) {
-			if !check {
-				check = !state.hasKings()
-			}
+func (board chessState) moveToBoard(m move, isPurple bool) chessState {
+	color := colorFlag(isPurple) | 1
+	var state chessState
+	copy(state[:], board[:])
+	for pos, piece := range state {
+		state[pos] = piece &^ passantFlag
+	}
+	if m.castling != 0 {
+		rank := uint(1)
+		if !isPurple {
+			rank = 8
+		}
+		state[position('e', rank)] = 0
+		rookFile, rookDest, kingDest := byte('h'), byte('f'), byte('g')
+		if m.castling == 'q' {
+			rookFile, rookDest, kingDest = 'a', 'd', 'c'
+		}
+		state[position(rookFile, rank)] = 0
+		state[position(rookDest, rank)] = rook | color
+		state[position(kingDest, rank)] = king | color
+	} else if m.promotion != rune(0) {
+		state[m.depart] = 0
+		state[m.dest] = pieceValue(m.promotion) | color
+	} else {
+		state[m.depart] = 0
+		state[m.dest] = pieceValue(m.piece) | color
+		if pieceValue(m.piece) == pawn {
+			board.movePawn(&state, m)
 		}
-		board.InactiveCheckMate = check
 	}
-	boards := make(chan chessState, 32)
-	go func() {
-		defer close(boards)
-		for state := range board.Board.movesToBoards(board.Board.movesForBoard(isPurple), isPurple) {
-			if board.InactiveCheckMate {
-				if !state.hasKings() {
-					boards <- state
-				}
-			} else {
-				boards <- state
-			}
+	return state
+}
+
+// moveGenerator generates the legal moves of the active side.
+type moveGenerator interface {
+	appendMoves(moves []move, board chessState, isPurple bool) []move
+}
+
+// channelGenerator channel move generator.
+type channelGenerator struct{}
+
+func (channelGenerator) appendMoves(moves []move, board chessState, isPurple bool) []move {
+	if !board.hasKings() {
+		return moves
+	}
+	for m := range board.movesForBoard(isPurple) {
+		moves = append(moves, m)
+	}
+	return moves
+}
+
+var generator moveGenerator = bitboardGenerator{}
+
+func (board chessState) moveList(isPurple bool) []move {
+	return generator.appendMoves(make([]move, 0, 32), board, isPurple)
+}
+
+func (board chessState) findMove(moves []move, next chessState, isPurple bool) (move, bool) {
+	for _, m := range moves {
+		if board.moveToBoard(m, isPurple).swap() == next {
+			return m, true
 		}
-	}()
+	}
+	return move{}, false
+}
+
+func (board Board) lookaheadBoards(isPurple bool) <-chan chessState {
+	moves := board.Board.moveList(isPurple)
+	boards := make(chan chessState, len(moves))
+	for _, m := range moves {
+		boards <- board.Board.moveToBoard(m, isPurple)
+	}
+	close(boards)
 	return boards
 }
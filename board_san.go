@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var valueToSAN = map[uint8]string{
+	bishop: "B",
+	king:   "K",
+	knight: "N",
+	queen:  "Q",
+	rook:   "R",
+}
+
+func pieceValue(piece rune) uint8 {
+	if value, ok := pieceToValuePurple[piece]; ok {
+		return value
+	}
+	return pieceToValueGreen[piece]
+}
+
+func disambiguate(m move, moves []move) string {
+	departFile, departRank := rankAndFile(m.depart)
+	ambiguous, fileUnique, rankUnique := false, true, true
+	for _, other := range moves {
+		if other.castling != 0 || other.depart == m.depart || other.dest != m.dest || pieceValue(other.piece) != pieceValue(m.piece) {
+			continue
+		}
+		ambiguous = true
+		file, rank := rankAndFile(other.depart)
+		if file == departFile {
+			fileUnique = false
+		}
+		if rank == departRank {
+			rankUnique = false
+		}
+	}
+	if !ambiguous {
+		return ""
+	} else if fileUnique {
+		return fmt.Sprintf("%c", departFile)
+	} else if rankUnique {
+		return fmt.Sprintf("%d", departRank)
+	}
+	return fmt.Sprintf("%c%d", departFile, departRank)
+}
+
+func (board chessState) san(m move, moves []move, isPurple bool) string {
+	var san string
+	if m.castling == 'k' {
+		san = "O-O"
+	} else if m.castling == 'q' {
+		san = "O-O-O"
+	} else {
+		departFile, _ := rankAndFile(m.depart)
+		destFile, destRank := rankAndFile(m.dest)
+		if piece := pieceValue(m.piece); piece == pawn {
+			if departFile != destFile {
+				san = fmt.Sprintf("%cx", departFile)
+			}
+		} else {
+			san = valueToSAN[piece] + disambiguate(m, moves)
+			if m.capture {
+				san = san + "x"
+			}
+		}
+		san = san + fmt.Sprintf("%c%d", destFile, destRank)
+		if m.promotion != rune(0) {
+			san = san + "=" + valueToSAN[pieceValue(m.promotion)]
+		}
+	}
+	next := board.moveToBoard(m, isPurple).swap()
+	if next.inCheck(!isPurple) {
+		if len(next.moveList(!isPurple)) == 0 {
+			san = san + "#"
+		} else {
+			san = san + "+"
+		}
+	}
+	return san
+}
+
+var sanPattern = regexp.MustCompile(`^([BKNQR])?([a-h])?([1-8])?(x)?([a-h][1-8])(=?([BNQR]))?$`)
+
+var sanToValue = map[byte]uint8{
+	'B': bishop,
+	'K': king,
+	'N': knight,
+	'Q': queen,
+	'R': rook,
+}
+
+func (board chessState) parseSAN(san string, moves []move) (move, error) {
+	s := strings.TrimRight(san, "+#!?")
+	var castling byte
+	switch s {
+	case "O-O", "0-0":
+		castling = 'k'
+	case "O-O-O", "0-0-0":
+		castling = 'q'
+	}
+	if castling != 0 {
+		for _, m := range moves {
+			if m.castling == castling {
+				return m, nil
+			}
+		}
+		return move{}, fmt.Errorf("illegal san %q", san)
+	}
+	match := sanPattern.FindStringSubmatch(s)
+	if match == nil {
+		return move{}, fmt.Errorf("invalid san %q", san)
+	}
+	piece := pawn
+	if match[1] != "" {
+		piece = sanToValue[match[1][0]]
+	}
+	dest := position(match[5][0], uint(match[5][1]-'0'))
+	found := make([]move, 0, 1)
+	for _, m := range moves {
+		if m.castling != 0 || m.dest != dest || pieceValue(m.piece) != piece {
+			continue
+		}
+		file, rank := rankAndFile(m.depart)
+		if match[2] != "" && file != match[2][0] {
+			continue
+		}
+		if match[3] != "" && rank != uint(match[3][0]-'0') {
+			continue
+		}
+		if match[7] == "" && m.promotion != rune(0) {
+			continue
+		}
+		if match[7] != "" && (m.promotion == rune(0) || pieceValue(m.promotion) != sanToValue[match[7][0]]) {
+			continue
+		}
+		found = append(found, m)
+	}
+	if len(found) == 0 {
+		return move{}, fmt.Errorf("illegal san %q", san)
+	} else if len(found) > 1 {
+		return move{}, fmt.Errorf("ambiguous san %q", san)
+	}
+	return found[0], nil
+}
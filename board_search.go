@@ -0,0 +1,252 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"time"
+)
+
+const (
+	mateScore         = 1000000
+	infiniteScore     = mateScore + 1
+	alphabetaDepth    = 4
+	alphabetaMoveTime = time.Second
+)
+
+// pieceScores centipawn values indexed by piece type >> 1.
+var pieceScores = [8]int{0, 330, 0, 320, 100, 900, 500, 0}
+
+// material scores the board for the active side.
+func (board chessState) material() int {
+	score := 0
+	for _, piece := range board {
+		if activePiece(piece) {
+			score = score + pieceScores[piece&0xE>>1]
+		} else if inactivePiece(piece) {
+			score = score - pieceScores[piece&0xE>>1]
+		}
+	}
+	return score
+}
+
+func (board chessState) moveOrder(m move, first move) int {
+	if m == first {
+		return math.MaxInt32
+	}
+	score := 0
+	if m.capture {
+		victim := pieceScores[pawn>>1]
+		if board[m.dest] != 0 {
+			victim = pieceScores[board[m.dest]&0xE>>1]
+		}
+		score = mateScore + 10*victim - pieceScores[pieceValue(m.piece)>>1]
+	}
+	if m.promotion != rune(0) {
+		score = score + mateScore + pieceScores[pieceValue(m.promotion)>>1]
+	}
+	return score
+}
+
+// orderMoves sorts first, then captures by most valuable victim and least
+// valuable attacker, then promotions ahead of quiet moves.
+func (board chessState) orderMoves(moves []move, first move) {
+	var scores [256]int
+	for i, m := range moves {
+		scores[i] = board.moveOrder(m, first)
+	}
+	for i := 1; i < len(moves); i++ {
+		for j := i; j > 0 && scores[j] > scores[j-1]; j-- {
+			moves[j], moves[j-1] = moves[j-1], moves[j]
+			scores[j], scores[j-1] = scores[j-1], scores[j]
+		}
+	}
+}
+
+// evaluator scores boards for the active side and gives priors for moves,
+// or nil priors to order moves by captures.
+type evaluator interface {
+	evaluate(board chessState) int
+	priors(board chessState, moves []move, isPurple bool) []float64
+}
+
+type staticEvaluator struct{}
+
+func (staticEvaluator) evaluate(board chessState) int {
+	return board.evaluate().Total
+}
+
+func (staticEvaluator) priors(board chessState, moves []move, isPurple bool) []float64 {
+	return nil
+}
+
+// orderPriors sorts the moves by descending prior, keeping first in front.
+func orderPriors(moves []move, priors []float64, first move) {
+	for i := 1; i < len(moves); i++ {
+		for j := i; j > 0 && (moves[j] == first || moves[j-1] != first && priors[j] > priors[j-1]); j-- {
+			moves[j], moves[j-1] = moves[j-1], moves[j]
+			priors[j], priors[j-1] = priors[j-1], priors[j]
+		}
+	}
+}
+
+// searcher searcher.
+type searcher struct {
+	eval     evaluator
+	deadline time.Time
+	nodes    uint64
+	stopped  bool
+	buffers  [][]move
+	table    *transpositionTable
+}
+
+func (s *searcher) timeUp() bool {
+	if s.nodes&1023 == 0 && time.Now().After(s.deadline) {
+		s.stopped = true
+	}
+	return s.stopped
+}
+
+func (s *searcher) moves(board chessState, isPurple bool, ply int) []move {
+	for len(s.buffers) <= ply {
+		s.buffers = append(s.buffers, make([]move, 0, 64))
+	}
+	s.buffers[ply] = generator.appendMoves(s.buffers[ply][:0], board, isPurple)
+	return s.buffers[ply]
+}
+
+func (s *searcher) quiesce(board chessState, isPurple bool, ply, alpha, beta int) int {
+	s.nodes = s.nodes + 1
+	if s.timeUp() {
+		return 0
+	}
+	standPat := s.eval.evaluate(board)
+	if standPat >= beta {
+		return beta
+	}
+	if standPat > alpha {
+		alpha = standPat
+	}
+	moves := s.moves(board, isPurple, ply)
+	board.orderMoves(moves, move{})
+	for _, m := range moves {
+		if !m.capture && m.promotion == rune(0) {
+			continue
+		}
+		score := -s.quiesce(board.moveToBoard(m, isPurple).swap(), !isPurple, ply+1, -beta, -alpha)
+		if s.stopped {
+			return 0
+		}
+		if score >= beta {
+			return beta
+		}
+		if score > alpha {
+			alpha = score
+		}
+	}
+	return alpha
+}
+
+func (s *searcher) negamax(board chessState, isPurple bool, depth, ply, alpha, beta int) int {
+	s.nodes = s.nodes + 1
+	if s.timeUp() {
+		return 0
+	}
+	if depth <= 0 {
+		return s.quiesce(board, isPurple, ply, alpha, beta)
+	}
+	key := board.zobrist()
+	var first move
+	if entry, ok := s.table.probe(key); ok {
+		first = entry.best
+		if int(entry.depth) >= depth {
+			score := scoreFromTable(int(entry.score), ply)
+			switch {
+			case entry.bound == boundExact:
+				return score
+			case entry.bound == boundLower && score >= beta:
+				return beta
+			case entry.bound == boundUpper && score <= alpha:
+				return alpha
+			}
+		}
+	}
+	moves := s.moves(board, isPurple, ply)
+	if len(moves) == 0 {
+		if board.inCheck(isPurple) {
+			return ply - mateScore
+		}
+		return 0
+	}
+	board.orderMoves(moves, first)
+	bound, best := boundUpper, moves[0]
+	for _, m := range moves {
+		score := -s.negamax(board.moveToBoard(m, isPurple).swap(), !isPurple, depth-1, ply+1, -beta, -alpha)
+		if s.stopped {
+			return 0
+		}
+		if score >= beta {
+			s.table.store(key, depth, boundLower, scoreToTable(beta, ply), m)
+			return beta
+		}
+		if score > alpha {
+			alpha, bound, best = score, boundExact, m
+		}
+	}
+	s.table.store(key, depth, bound, scoreToTable(alpha, ply), best)
+	return alpha
+}
+
+// alphabeta runs an iterative deepening negamax search with the static
+// evaluation and returns the best move of the last completed iteration with
+// its score.
+func (board chessState) alphabeta(isPurple bool, depth int, moveTime time.Duration) (move, int, error) {
+	return board.alphabetaWith(staticEvaluator{}, searchTable, isPurple, depth, moveTime)
+}
+
+// alphabetaWith searches with the evaluator, keeping its scores in table.
+func (board chessState) alphabetaWith(eval evaluator, table *transpositionTable, isPurple bool, depth int, moveTime time.Duration) (move, int, error) {
+	if depth <= 0 {
+		depth = alphabetaDepth
+	}
+	if moveTime <= 0 {
+		moveTime = alphabetaMoveTime
+	}
+	moves := board.moveList(isPurple)
+	if len(moves) == 0 {
+		return move{}, 0, errors.New("no moves available")
+	}
+	table.nextGeneration()
+	s := &searcher{eval: eval, deadline: time.Now().Add(moveTime), table: table}
+	priors := eval.priors(board, moves, isPurple)
+	if priors != nil {
+		orderPriors(moves, priors, move{})
+	} else {
+		board.orderMoves(moves, move{})
+	}
+	best, bestScore := moves[0], 0
+	for d := 1; d <= depth; d++ {
+		if priors != nil {
+			orderPriors(moves, priors, best)
+		} else {
+			board.orderMoves(moves, best)
+		}
+		alpha, iterationBest := -infiniteScore, moves[0]
+		for _, m := range moves {
+			score := -s.negamax(board.moveToBoard(m, isPurple).swap(), !isPurple, d-1, 1, -infiniteScore, -alpha)
+			if s.stopped {
+				break
+			}
+			if score > alpha {
+				alpha, iterationBest = score, m
+			}
+		}
+		if s.stopped {
+			break
+		}
+		best, bestScore = iterationBest, alpha
+		if bestScore >= mateScore-d {
+			break
+		}
+	}
+	return best, bestScore, nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+func searchFEN(c *C, fen string, depth int) (string, int) {
+	board, _, _, err := parseFEN(fen)
+	c.Assert(err, IsNil)
+	isPurple := board.activePurple()
+	m, score, err := board.alphabeta(isPurple, depth, time.Minute)
+	c.Assert(err, IsNil)
+	return m.uci(isPurple), score
+}
+
+func (s *NKnightSuite) TestMaterial(c *C) {
+	c.Assert(initialBoard.material(), Equals, 0)
+	board, _, _, err := parseFEN("4k3/8/8/3q4/8/8/3R4/4K3 b - - 0 1")
+	c.Assert(err, IsNil)
+	c.Assert(board.material(), Equals, 400)
+	c.Assert(board.swap().material(), Equals, -400)
+}
+
+func (s *NKnightSuite) TestOrderMoves(c *C) {
+	board, _, _, err := parseFEN("4k3/8/8/3q4/2P5/8/3R4/4K3 w - - 0 1")
+	c.Assert(err, IsNil)
+	moves := board.moveList(true)
+	board.orderMoves(moves, move{})
+	c.Assert(moves[0].uci(true), Equals, "c4d5")
+	c.Assert(moves[1].uci(true), Equals, "d2d5")
+	board.orderMoves(moves, moves[5])
+	c.Assert(moves[1].uci(true), Equals, "c4d5")
+}
+
+func (s *NKnightSuite) TestAlphaBeta(c *C) {
+	m, score := searchFEN(c, "6k1/5ppp/8/8/8/8/5PPP/R5K1 w - - 0 1", 4)
+	c.Assert(m, Equals, "a1a8")
+	c.Assert(score, Equals, mateScore-1)
+	m, score = searchFEN(c, "4k3/8/8/3q4/8/8/3R4/4K3 w - - 0 1", 2)
+	c.Assert(m, Equals, "d2d5")
+	c.Assert(score > 400 && score < 600, Equals, true)
+	m, _ = searchFEN(c, "4k3/8/2p5/3p4/8/8/8/3QK3 w - - 0 1", 1)
+	c.Assert(m, Not(Equals), "d1d5")
+
+	board, _, _, err := parseFEN("7k/5Q2/6K1/8/8/8/8/8 b - - 0 1")
+	c.Assert(err, IsNil)
+	_, _, err = board.alphabeta(false, 3, time.Second)
+	c.Assert(err, ErrorMatches, "no moves available")
+
+	start := time.Now()
+	_, _, err = initialBoard.alphabeta(true, 64, 50*time.Millisecond)
+	c.Assert(err, IsNil)
+	c.Assert(time.Since(start) < time.Second, Equals, true)
+}
+
+func (s *NKnightSuite) TestPlayAlphaBeta(c *C) {
+	var game gameResponse
+	s.post201(c, "games", gameRequest{}, &game)
+	agent := s.addUser(c, game.Game.GameID)
+	s.post400(c, "agents", agentRequest{Type: "alphabeta", GameID: game.Game.GameID, Depth: -1}, "depth, playouts and move time must not be negative")
+	var response gameResponse
+	s.post201(c, "agents", agentRequest{Type: "alphabeta", GameID: game.Game.GameID, Depth: 2, MoveTime: 500}, &response)
+	c.Assert(response.Game.InactiveAgentDepth, Equals, 2)
+	c.Assert(response.Game.InactiveAgentMoveTime, Equals, 500)
+	response = *s.playSAN(c, agent, "e4")
+	c.Assert(response.Game.MoveCount, Equals, 2)
+	c.Assert(response.Game.ActiveAgentType, Equals, "user")
+	c.Assert(response.Game.InactiveAgentType, Equals, "alphabeta")
+	c.Assert(response.Game.InactiveAgentDepth, Equals, 2)
+}
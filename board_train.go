@@ -0,0 +1,309 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+)
+
+const (
+	trainEpochs     = 10
+	trainBatch      = 256
+	trainRate       = 0.001
+	trainValidation = 0.1
+	adamBeta1       = 0.9
+	adamBeta2       = 0.999
+	adamEpsilon     = 1e-8
+)
+
+var versionPattern = regexp.MustCompile(`^network-(\d+)\.nn$`)
+
+// trainingSample features of a board with the result for its active side,
+// 1 for a win, 0.5 for a draw and 0 for a loss.
+type trainingSample struct {
+	features []int
+	target   float32
+}
+
+func resultTarget(result gameResult, isPurple bool) (float32, bool) {
+	switch result {
+	case winner(isPurple):
+		return 1, true
+	case winner(!isPurple):
+		return 0, true
+	case resultDraw:
+		return 0.5, true
+	}
+	return 0, false
+}
+
+// trainingSamples reads every position of a finished game, including games
+// the idle loop has since deleted.
+func trainingSamples() ([]trainingSample, error) {
+	rows, err := store.finishedPositions()
+	if err != nil {
+		return nil, err
+	}
+	samples := make([]trainingSample, 0, len(rows))
+	for _, row := range rows {
+		target, ok := resultTarget(row.Result, row.Board.activePurple())
+		if !ok {
+			continue
+		}
+		samples = append(samples, trainingSample{features: row.Board.features(nil), target: target})
+	}
+	return samples, nil
+}
+
+func sigmoid(x float32) float32 {
+	return float32(1 / (1 + math.Exp(-float64(x))))
+}
+
+// crossEntropy loss of the network output against the target.
+func crossEntropy(output, target float32) float64 {
+	p := math.Min(math.Max(float64(sigmoid(output)), 1e-7), 1-1e-7)
+	return -(float64(target)*math.Log(p) + (1-float64(target))*math.Log(1-p))
+}
+
+func (net *network) loss(samples []trainingSample) float64 {
+	if len(samples) == 0 {
+		return 0
+	}
+	activations := make([]float32, 0, net.hidden)
+	total := 0.0
+	for _, sample := range samples {
+		var output float32
+		activations, output = net.forward(sample.features, activations)
+		total = total + crossEntropy(output, sample.target)
+	}
+	return total / float64(len(samples))
+}
+
+// adam Adam optimiser state for one parameter tensor.
+type adam struct {
+	values    []float32
+	gradients []float32
+	m         []float32
+	v         []float32
+}
+
+func newAdam(values []float32) *adam {
+	return &adam{values: values, gradients: make([]float32, len(values)), m: make([]float32, len(values)), v: make([]float32, len(values))}
+}
+
+func (a *adam) step(rate float64, t int, scale float32) {
+	correction1 := 1 - math.Pow(adamBeta1, float64(t))
+	correction2 := 1 - math.Pow(adamBeta2, float64(t))
+	for i, g := range a.gradients {
+		g = g * scale
+		a.m[i] = adamBeta1*a.m[i] + (1-adamBeta1)*g
+		a.v[i] = adamBeta2*a.v[i] + (1-adamBeta2)*g*g
+		update := rate * (float64(a.m[i]) / correction1) / (math.Sqrt(float64(a.v[i])/correction2) + adamEpsilon)
+		a.values[i] = a.values[i] - float32(update)
+		a.gradients[i] = 0
+	}
+}
+
+// trainer trains a network with Adam on the cross entropy of its output.
+type trainer struct {
+	net         *network
+	weights     *adam
+	biases      *adam
+	output      *adam
+	bias        *adam
+	activations []float32
+	steps       int
+}
+
+func newTrainer(net *network) *trainer {
+	bias := []float32{net.bias}
+	return &trainer{net: net, weights: newAdam(net.weights), biases: newAdam(net.biases), output: newAdam(net.output), bias: newAdam(bias), activations: make([]float32, 0, net.hidden)}
+}
+
+func (t *trainer) backward(sample trainingSample) float64 {
+	net := t.net
+	var output float32
+	t.activations, output = net.forward(sample.features, t.activations)
+	d := sigmoid(output) - sample.target
+	t.bias.gradients[0] = t.bias.gradients[0] + d
+	for i, a := range t.activations {
+		t.output.gradients[i] = t.output.gradients[i] + d*a
+		if a <= 0 || a >= 1 {
+			continue
+		}
+		g := d * net.output[i]
+		t.biases.gradients[i] = t.biases.gradients[i] + g
+		for _, feature := range sample.features {
+			t.weights.gradients[feature*net.hidden+i] = t.weights.gradients[feature*net.hidden+i] + g
+		}
+	}
+	return crossEntropy(output, sample.target)
+}
+
+// batch takes one optimiser step over the samples and returns their loss.
+func (t *trainer) batch(samples []trainingSample, rate float64) float64 {
+	total := 0.0
+	for _, sample := range samples {
+		total = total + t.backward(sample)
+	}
+	t.steps = t.steps + 1
+	scale := 1 / float32(len(samples))
+	for _, a := range []*adam{t.weights, t.biases, t.output, t.bias} {
+		a.step(rate, t.steps, scale)
+	}
+	t.net.bias = t.bias.values[0]
+	return total / float64(len(samples))
+}
+
+// epoch shuffles the samples and trains on them in batches.
+func (t *trainer) epoch(samples []trainingSample, batch int, rate float64, random *rand.Rand) float64 {
+	random.Shuffle(len(samples), func(i, j int) {
+		samples[i], samples[j] = samples[j], samples[i]
+	})
+	total := 0.0
+	for start := 0; start < len(samples); start = start + batch {
+		end := start + batch
+		if end > len(samples) {
+			end = len(samples)
+		}
+		total = total + t.batch(samples[start:end], rate)*float64(end-start)
+	}
+	return total / float64(len(samples))
+}
+
+// splitSamples holds back a fraction of the samples for validation.
+func splitSamples(samples []trainingSample, fraction float64, random *rand.Rand) ([]trainingSample, []trainingSample) {
+	random.Shuffle(len(samples), func(i, j int) {
+		samples[i], samples[j] = samples[j], samples[i]
+	})
+	held := int(float64(len(samples)) * fraction)
+	return samples[held:], samples[:held]
+}
+
+// networkVersions lists the versioned weight files in dir by version.
+func networkVersions(dir string) (map[int]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	versions := map[int]string{}
+	for _, entry := range entries {
+		match := versionPattern.FindStringSubmatch(entry.Name())
+		if match == nil || entry.IsDir() {
+			continue
+		}
+		version, err := strconv.Atoi(match[1])
+		if err != nil {
+			continue
+		}
+		versions[version] = filepath.Join(dir, entry.Name())
+	}
+	return versions, nil
+}
+
+// latestNetwork returns path itself, or the newest versioned weight file when
+// path is a directory.
+func latestNetwork(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		return path, nil
+	}
+	versions, err := networkVersions(path)
+	if err != nil {
+		return "", err
+	}
+	latest, file := -1, ""
+	for version, name := range versions {
+		if version > latest {
+			latest, file = version, name
+		}
+	}
+	if latest < 0 {
+		return "", fmt.Errorf("no weight files in %s", path)
+	}
+	return file, nil
+}
+
+// saveVersion writes the network as the next version in dir, renaming it
+// into place so a loading server never sees a partial file.
+func saveVersion(net *network, dir string) (string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	versions, err := networkVersions(dir)
+	if err != nil {
+		return "", err
+	}
+	next := 1
+	for version := range versions {
+		if version >= next {
+			next = version + 1
+		}
+	}
+	path := filepath.Join(dir, fmt.Sprintf("network-%04d.nn", next))
+	if err := saveNetwork(net, path+".tmp"); err != nil {
+		return "", err
+	}
+	return path, os.Rename(path+".tmp", path)
+}
+
+func trainCommand(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("train", flag.ContinueOnError)
+	epochs := flags.Int("epochs", trainEpochs, "passes over the training positions")
+	batch := flags.Int("batch", trainBatch, "positions per optimiser step")
+	rate := flags.Float64("rate", trainRate, "Adam learning rate")
+	validation := flags.Float64("validation", trainValidation, "fraction of positions held back for validation")
+	hidden := flags.Int("hidden", neuralHidden, "hidden layer size of a new network")
+	from := flags.String("from", "", "weight file or directory to continue training from")
+	seed := flags.Int64("seed", 1, "random seed")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errors.New("usage: nknight train [flags] <weights directory>")
+	}
+	if *epochs < 1 || *batch < 1 || *hidden < 1 || *rate <= 0 || *validation < 0 || *validation >= 1 {
+		return errors.New("epochs, batch, hidden and rate must be positive and validation in [0, 1)")
+	}
+	random := rand.New(rand.NewSource(*seed))
+	net := newNetwork(*hidden, random)
+	if *from != "" {
+		path, err := latestNetwork(*from)
+		if err != nil {
+			return err
+		}
+		if net, err = loadNetwork(path); err != nil {
+			return err
+		}
+	}
+	samples, err := trainingSamples()
+	if err != nil {
+		return err
+	}
+	if len(samples) == 0 {
+		return errors.New("no positions from finished games")
+	}
+	train, validate := splitSamples(samples, *validation, random)
+	fmt.Fprintf(out, "positions %d training %d validation %d\n", len(samples), len(train), len(validate))
+	t := newTrainer(net)
+	for epoch := 1; epoch <= *epochs; epoch++ {
+		loss := t.epoch(train, *batch, *rate, random)
+		fmt.Fprintf(out, "epoch %d training loss %.6f validation loss %.6f\n", epoch, loss, net.loss(validate))
+	}
+	path, err := saveVersion(net, flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "wrote %s\n", path)
+	return nil
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *NKnightSuite) TestResultTarget(c *C) {
+	for _, t := range []struct {
+		result   gameResult
+		isPurple bool
+		target   float32
+		ok       bool
+	}{
+		{resultPurple, true, 1, true},
+		{resultPurple, false, 0, true},
+		{resultGreen, false, 1, true},
+		{resultDraw, true, 0.5, true},
+		{resultNone, true, 0, false},
+	} {
+		target, ok := resultTarget(t.result, t.isPurple)
+		c.Assert(target, Equals, t.target)
+		c.Assert(ok, Equals, t.ok)
+	}
+}
+
+func (s *NKnightSuite) TestTrainer(c *C) {
+	random := rand.New(rand.NewSource(3))
+	samples := []trainingSample{}
+	for _, fen := range []string{
+		"4k3/8/8/8/8/8/8/2QQK3 w - - 0 1",
+		"4k3/8/8/8/8/8/8/2QQK3 b - - 0 1",
+		"2qqk3/8/8/8/8/8/8/4K3 w - - 0 1",
+	} {
+		board, _, _, err := parseFEN(fen)
+		c.Assert(err, IsNil)
+		result := resultPurple
+		if fen[0] == '2' {
+			result = resultGreen
+		}
+		target, _ := resultTarget(result, board.activePurple())
+		samples = append(samples, trainingSample{features: board.features(nil), target: target})
+	}
+	net := newNetwork(8, random)
+	before := net.loss(samples)
+	t := newTrainer(net)
+	for i := 0; i < 200; i++ {
+		t.epoch(samples, 2, 0.01, random)
+	}
+	c.Assert(net.loss(samples) < before/2, Equals, true)
+	train, validate := splitSamples(append([]trainingSample{}, samples...), 0.34, random)
+	c.Assert(train, HasLen, 2)
+	c.Assert(validate, HasLen, 1)
+}
+
+func (s *NKnightSuite) TestNetworkVersions(c *C) {
+	dir, err := os.MkdirTemp("", "nknight")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+	original := currentNetwork()
+	defer func() {
+		setNetwork(original)
+		neural.path = ""
+	}()
+
+	_, err = latestNetwork(dir)
+	c.Assert(err, ErrorMatches, "no weight files in .*")
+	first := newNetwork(4, rand.New(rand.NewSource(4)))
+	path, err := saveVersion(first, dir)
+	c.Assert(err, IsNil)
+	c.Assert(filepath.Base(path), Equals, "network-0001.nn")
+	c.Assert(watchNetwork(dir), IsNil)
+	c.Assert(currentNetwork(), DeepEquals, first)
+
+	second := newNetwork(4, rand.New(rand.NewSource(5)))
+	path, err = saveVersion(second, dir)
+	c.Assert(err, IsNil)
+	c.Assert(filepath.Base(path), Equals, "network-0002.nn")
+	c.Assert(reloadNetwork(), IsNil)
+	c.Assert(currentNetwork(), DeepEquals, first)
+	neural.checked = time.Time{}
+	c.Assert(reloadNetwork(), IsNil)
+	c.Assert(currentNetwork(), DeepEquals, second)
+	latest, err := latestNetwork(dir)
+	c.Assert(err, IsNil)
+	c.Assert(latest, Equals, path)
+}
+
+func (s *NKnightSuite) TestTrainCommand(c *C) {
+	var game gameResponse
+	s.post201(c, "games", gameRequest{}, &game)
+	agent1 := s.addUser(c, game.Game.GameID)
+	agent2 := s.addUser(c, game.Game.GameID)
+	for i, san := range []string{"f3", "e5", "g4", "Qh4#"} {
+		agent := agent1
+		if i%2 == 1 {
+			agent = agent2
+		}
+		s.playSAN(c, agent, san)
+	}
+	samples, err := trainingSamples()
+	c.Assert(err, IsNil)
+	c.Assert(len(samples) >= 5, Equals, true)
+
+	dir, err := os.MkdirTemp("", "nknight")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+	var out bytes.Buffer
+	c.Assert(trainCommand([]string{"-epochs", "2", "-hidden", "4", dir}, &out), IsNil)
+	c.Assert(out.String(), Matches, `(?s)positions \d+ training \d+ validation \d+\nepoch 1 training loss [0-9.]+ validation loss [0-9.]+\nepoch 2 .*wrote .*network-0001.nn\n`)
+	out.Reset()
+	c.Assert(trainCommand([]string{"-epochs", "1", "-from", dir, dir}, &out), IsNil)
+	c.Assert(out.String(), Matches, `(?s).*wrote .*network-0002.nn\n`)
+	c.Assert(trainCommand([]string{"-epochs", "0", dir}, &out), ErrorMatches, "epochs, batch, hidden and rate .*")
+	c.Assert(trainCommand([]string{}, &out), ErrorMatches, "usage: .*")
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// uci formats m in UCI long algebraic notation, which uses absolute
+// coordinates whichever side is to move.
+func (m move) uci(isPurple bool) string {
+	if m.castling != 0 {
+		rank := 1
+		if !isPurple {
+			rank = 8
+		}
+		if m.castling == 'q' {
+			return fmt.Sprintf("e%dc%d", rank, rank)
+		}
+		return fmt.Sprintf("e%dg%d", rank, rank)
+	}
+	departFile, departRank := rankAndFile(m.depart)
+	destFile, destRank := rankAndFile(m.dest)
+	promotion := ""
+	if m.promotion != rune(0) {
+		promotion = string(valueToFEN[pieceValue(m.promotion)])
+	}
+	return fmt.Sprintf("%c%d%c%d%s", departFile, departRank, destFile, destRank, promotion)
+}
+
+var uciPattern = regexp.MustCompile(`^[a-h][1-8][a-h][1-8][bnqr]?$`)
+
+func parseUCI(uci string, moves []move, isPurple bool) (move, error) {
+	if !uciPattern.MatchString(uci) {
+		return move{}, fmt.Errorf("invalid uci %q", uci)
+	}
+	for _, m := range moves {
+		if m.uci(isPurple) == uci {
+			return m, nil
+		}
+	}
+	return move{}, fmt.Errorf("illegal uci %q", uci)
+}
@@ -0,0 +1,146 @@
+package main
+
+import "sync"
+
+// zobristKeys random keys for pieces by color, piece type >> 1 and square,
+// castling rights, en passant file and side to move. The keys are generated
+// from a fixed seed so stored hashes stay valid between runs.
+var zobristKeys struct {
+	pieces  [2][8][64]uint64
+	castle  [2][2]uint64
+	passant [8]uint64
+	purple  uint64
+}
+
+func splitmix64(state *uint64) uint64 {
+	*state = *state + 0x9E3779B97F4A7C15
+	z := *state
+	z = (z ^ (z >> 30)) * 0xBF58476D1CE4E5B9
+	z = (z ^ (z >> 27)) * 0x94D049BB133111EB
+	return z ^ (z >> 31)
+}
+
+func init() {
+	seed := uint64(0x6E6B6E69676874)
+	for color := range zobristKeys.pieces {
+		for piece := range zobristKeys.pieces[color] {
+			for sq := range zobristKeys.pieces[color][piece] {
+				zobristKeys.pieces[color][piece][sq] = splitmix64(&seed)
+			}
+		}
+	}
+	for color := range zobristKeys.castle {
+		for side := range zobristKeys.castle[color] {
+			zobristKeys.castle[color][side] = splitmix64(&seed)
+		}
+	}
+	for file := range zobristKeys.passant {
+		zobristKeys.passant[file] = splitmix64(&seed)
+	}
+	zobristKeys.purple = splitmix64(&seed)
+}
+
+// zobrist hashes the position including side to move, castling rights and
+// en passant target.
+func (board chessState) zobrist() uint64 {
+	isPurple := board.activePurple()
+	var hash uint64
+	for sq, piece := range board {
+		if piece&0xE == 0 {
+			continue
+		}
+		color := colorIndex(isPurple == activePiece(piece))
+		hash = hash ^ zobristKeys.pieces[color][piece&0xE>>1][sq]
+	}
+	for _, purple := range []bool{true, false} {
+		if board.castleRight(purple, 'h') {
+			hash = hash ^ zobristKeys.castle[colorIndex(purple)][0]
+		}
+		if board.castleRight(purple, 'a') {
+			hash = hash ^ zobristKeys.castle[colorIndex(purple)][1]
+		}
+	}
+	if target, ok := board.passantTarget(); ok {
+		hash = hash ^ zobristKeys.passant[target%8]
+	}
+	if isPurple {
+		hash = hash ^ zobristKeys.purple
+	}
+	return hash
+}
+
+const (
+	boundExact uint8 = iota + 1
+	boundLower
+	boundUpper
+)
+
+// ttEntry transposition table entry.
+type ttEntry struct {
+	key        uint64
+	best       move
+	score      int32
+	depth      int8
+	bound      uint8
+	generation uint8
+}
+
+// transpositionTable transposition table.
+type transpositionTable struct {
+	lock       sync.Mutex
+	entries    []ttEntry
+	mask       uint64
+	generation uint8
+}
+
+func newTranspositionTable(bits uint) *transpositionTable {
+	return &transpositionTable{entries: make([]ttEntry, 1<<bits), mask: 1<<bits - 1}
+}
+
+var searchTable = newTranspositionTable(18)
+
+// nextGeneration ages the entries of earlier searches so they are replaced
+// first.
+func (table *transpositionTable) nextGeneration() {
+	table.lock.Lock()
+	defer table.lock.Unlock()
+	table.generation = table.generation + 1
+}
+
+func (table *transpositionTable) probe(key uint64) (ttEntry, bool) {
+	table.lock.Lock()
+	defer table.lock.Unlock()
+	entry := table.entries[key&table.mask]
+	return entry, entry.bound != 0 && entry.key == key
+}
+
+// store keeps the new entry unless the slot holds a deeper result for a
+// different position from the current search.
+func (table *transpositionTable) store(key uint64, depth int, bound uint8, score int, best move) {
+	table.lock.Lock()
+	defer table.lock.Unlock()
+	entry := &table.entries[key&table.mask]
+	if entry.bound != 0 && entry.key != key && entry.generation == table.generation && int(entry.depth) > depth {
+		return
+	}
+	*entry = ttEntry{key: key, best: best, score: int32(score), depth: int8(depth), bound: bound, generation: table.generation}
+}
+
+// scoreToTable stores mate scores relative to the node instead of the root.
+func scoreToTable(score, ply int) int {
+	if score > mateScore-256 {
+		return score + ply
+	} else if score < 256-mateScore {
+		return score - ply
+	}
+	return score
+}
+
+func scoreFromTable(score, ply int) int {
+	if score > mateScore-256 {
+		return score - ply
+	} else if score < 256-mateScore {
+		return score + ply
+	}
+	return score
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	. "gopkg.in/check.v1"
+)
+
+func zobristFEN(c *C, fen string) uint64 {
+	board, _, _, err := parseFEN(fen)
+	c.Assert(err, IsNil)
+	return board.zobrist()
+}
+
+func (s *NKnightSuite) TestZobrist(c *C) {
+	start := zobristFEN(c, initialFEN)
+	c.Assert(initialBoard.zobrist(), Equals, start)
+	c.Assert(zobristFEN(c, "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR b KQkq - 0 1"), Not(Equals), start)
+	c.Assert(zobristFEN(c, "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w Qkq - 0 1"), Not(Equals), start)
+	c.Assert(zobristFEN(c, "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQk - 0 1"), Not(Equals), start)
+	c.Assert(zobristFEN(c, "4k3/8/8/8/3pP3/8/8/4K3 b - e3 0 1"), Not(Equals), zobristFEN(c, "4k3/8/8/8/3pP3/8/8/4K3 b - - 0 1"))
+
+	board := initialBoard
+	for _, uci := range []string{"g1f3", "b8c6", "f3g1", "c6b8"} {
+		isPurple := board.activePurple()
+		m, err := parseUCI(uci, board.moveList(isPurple), isPurple)
+		c.Assert(err, IsNil)
+		board = board.moveToBoard(m, isPurple).swap()
+	}
+	c.Assert(board.zobrist(), Equals, start)
+}
+
+func (s *NKnightSuite) TestTranspositionTable(c *C) {
+	table := newTranspositionTable(2)
+	_, ok := table.probe(1)
+	c.Assert(ok, Equals, false)
+	table.store(1, 3, boundExact, 42, move{dest: 9})
+	entry, ok := table.probe(1)
+	c.Assert(ok, Equals, true)
+	c.Assert(entry.score, Equals, int32(42))
+	c.Assert(entry.best.dest, Equals, 9)
+	_, ok = table.probe(5)
+	c.Assert(ok, Equals, false)
+	table.store(5, 2, boundLower, 7, move{})
+	_, ok = table.probe(5)
+	c.Assert(ok, Equals, false)
+	table.store(5, 4, boundLower, 7, move{})
+	_, ok = table.probe(5)
+	c.Assert(ok, Equals, true)
+	table.nextGeneration()
+	table.store(1, 1, boundUpper, -3, move{})
+	entry, ok = table.probe(1)
+	c.Assert(ok, Equals, true)
+	c.Assert(entry.bound, Equals, boundUpper)
+	c.Assert(scoreFromTable(scoreToTable(mateScore-5, 3), 7), Equals, mateScore-9)
+	c.Assert(scoreFromTable(scoreToTable(-mateScore+5, 3), 7), Equals, -mateScore+9)
+	c.Assert(scoreFromTable(scoreToTable(120, 3), 7), Equals, 120)
+}
+
+func (s *NKnightSuite) TestBoardHash(c *C) {
+	state, _, _, err := parseFEN("4k3/8/8/8/8/8/8/R3K2R w KQ - 0 1")
+	c.Assert(err, IsNil)
+	board, err := makeBoard(state)
+	c.Assert(err, IsNil)
+	c.Assert(board.Hash, Equals, int64(state.zobrist()))
+	again, err := makeBoard(state)
+	c.Assert(err, IsNil)
+	c.Assert(again.ID, Equals, board.ID)
+	found, err := getBoardByBoard(state)
+	c.Assert(err, IsNil)
+	c.Assert(found.ID, Equals, board.ID)
+	c.Assert(db.Exec("UPDATE boards SET hash = 0 WHERE id = ?", board.ID).Error, IsNil)
+	c.Assert(backfillHashes(db), IsNil)
+	found, err = getBoardByBoard(state)
+	c.Assert(err, IsNil)
+	c.Assert(found.Hash, Equals, int64(state.zobrist()))
+}
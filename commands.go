@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// command subcommand of the nknight binary.
+type command struct {
+	name    string
+	usage   string
+	storage bool
+	run     func(args []string, out io.Writer) error
+}
+
+var commands []command
+
+func init() {
+	commands = []command{
+		{"serve", "serve the HTTP API and run the idle loop", true, serveCommand},
+		{"selfplay", "play agents against each other and print the games as PGN", true, selfplayCommand},
+		{"perft", "count move generation nodes of a position", false, perftCommand},
+		{"import", "import PGN files into the board graph", true, importCommand},
+		{"export", "print finished games as PGN", true, exportCommand},
+		{"analyze", "evaluate and search a position", false, analyzeCommand},
+		{"migrate", "create or update the database schema", true, migrateCommand},
+		{"train", "train the evaluation network on finished games", true, trainCommand},
+		{"uci", "speak the UCI protocol on stdin and stdout", true, func(args []string, out io.Writer) error {
+			if len(args) != 0 {
+				return fmt.Errorf("uci takes no arguments")
+			}
+			return uciCommand(os.Stdin, out)
+		}},
+		{"xboard", "speak the xboard protocol on stdin and stdout", true, func(args []string, out io.Writer) error {
+			if len(args) != 0 {
+				return fmt.Errorf("xboard takes no arguments")
+			}
+			return xboardCommand(os.Stdin, out)
+		}},
+	}
+}
+
+func findCommand(name string) (command, bool) {
+	for _, c := range commands {
+		if c.name == name {
+			return c, true
+		}
+	}
+	return command{}, false
+}
+
+func printCommands(out io.Writer) {
+	fmt.Fprintln(out, "usage: nknight [flags] <command> [arguments]")
+	fmt.Fprintln(out)
+	for _, c := range commands {
+		fmt.Fprintf(out, "  %-10s %s\n", c.name, c.usage)
+	}
+}
+
+func serveCommand(args []string, out io.Writer) error {
+	if len(args) != 0 {
+		return fmt.Errorf("serve takes no arguments")
+	}
+	go func() {
+		for {
+			idle()
+		}
+	}()
+	Open(settings.Addr)
+	return nil
+}
+
+func importCommand(args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return fmt.Errorf("import takes one or more PGN files")
+	}
+	return importPGNFiles(args)
+}
+
+// migrateCommand reports the changes opening storage made, as opening it
+// migrates the schema and data.
+func migrateCommand(args []string, out io.Writer) error {
+	if len(args) != 0 {
+		return fmt.Errorf("migrate takes no arguments")
+	}
+	if len(migrations) == 0 {
+		fmt.Fprintf(out, "%s store is up to date\n", settings.Store)
+		return nil
+	}
+	for _, change := range migrations {
+		fmt.Fprintln(out, change)
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *NKnightSuite) TestCommands(c *C) {
+	var out bytes.Buffer
+	printCommands(&out)
+	for _, name := range []string{"serve", "selfplay", "perft", "import", "export", "analyze", "migrate", "train", "uci", "xboard"} {
+		command, ok := findCommand(name)
+		c.Assert(ok, Equals, true)
+		c.Assert(command.name, Equals, name)
+		c.Assert(strings.Contains(out.String(), "  "+name+" "), Equals, true)
+	}
+	_, ok := findCommand("fly")
+	c.Assert(ok, Equals, false)
+	command, _ := findCommand("perft")
+	c.Assert(command.storage, Equals, false)
+
+	c.Assert(migrateCommand([]string{"now"}, &out), ErrorMatches, "migrate takes no arguments")
+	c.Assert(serveCommand([]string{"now"}, &out), ErrorMatches, "serve takes no arguments")
+	c.Assert(importCommand(nil, &out), ErrorMatches, "import takes one or more PGN files")
+	for _, name := range []string{"uci", "xboard"} {
+		command, _ := findCommand(name)
+		c.Assert(command.run([]string{"now"}, &out), ErrorMatches, name+" takes no arguments")
+	}
+}
+
+func (s *NKnightSuite) TestMigrateCommand(c *C) {
+	previousDB, previousStore, previousMigrations := db, store, migrations
+	defer func() {
+		db, store, migrations = previousDB, previousStore, previousMigrations
+	}()
+	dir, err := os.MkdirTemp("", "nknight")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+	cfg := defaultConfig()
+	cfg.Store, cfg.DSN = "sqlite", filepath.Join(dir, "nknight.db")
+	c.Assert(openStorage(cfg), IsNil)
+	var out bytes.Buffer
+	c.Assert(migrateCommand(nil, &out), IsNil)
+	c.Assert(strings.Split(strings.TrimSpace(out.String()), "\n"), DeepEquals, []string{
+		"created table boards",
+		"created table game_play",
+		"created table games",
+		"created table positions",
+		"created table players",
+		"created table ratings",
+	})
+	c.Assert(db.Migrator().DropColumn(&Player{}, "Volatility"), IsNil)
+	c.Assert(Close(), IsNil)
+
+	c.Assert(openStorage(cfg), IsNil)
+	out.Reset()
+	c.Assert(migrateCommand(nil, &out), IsNil)
+	c.Assert(out.String(), Equals, "added column players.volatility\n")
+	c.Assert(Close(), IsNil)
+
+	c.Assert(openStorage(cfg), IsNil)
+	out.Reset()
+	c.Assert(migrateCommand(nil, &out), IsNil)
+	c.Assert(out.String(), Equals, settings.Store+" store is up to date\n")
+	c.Assert(Close(), IsNil)
+}
+
+func (s *NKnightSuite) TestAnalyzeCommand(c *C) {
+	var out bytes.Buffer
+	c.Assert(analyzeCommand([]string{"-depth", "2", "startpos"}, &out), IsNil)
+	c.Assert(out.String(), Matches, `fen rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1
+evaluation material 0 piece-square 0 mobility 0 king-safety 0 pawn-structure 0 total 0
+neural -?\d+
+moves 20
+bestmove [a-h][1-8][a-h][1-8] san \S+ score cp -?\d+ time \S+
+`)
+	out.Reset()
+	c.Assert(analyzeCommand([]string{"6k1/5ppp/8/8/8/8/5PPP/R5K1 w - - 0 1"}, &out), IsNil)
+	c.Assert(out.String(), Matches, `(?s).*bestmove a1a8 san Ra8# score cp 999999 .*`)
+	out.Reset()
+	c.Assert(analyzeCommand([]string{"R5k1/5ppp/8/8/8/8/5PPP/6K1 b - - 0 1"}, &out), IsNil)
+	c.Assert(out.String(), Matches, `(?s).*moves 0\nresult 1-0 \{checkmate\}\n`)
+	c.Assert(analyzeCommand(nil, &out), ErrorMatches, "usage: .*")
+	c.Assert(analyzeCommand([]string{"-depth", "0", "startpos"}, &out), ErrorMatches, "depth and movetime must be positive")
+}
+
+func (s *NKnightSuite) TestExportCommand(c *C) {
+	var game gameResponse
+	s.post201(c, "games", gameRequest{}, &game)
+	agent1 := s.addUser(c, game.Game.GameID)
+	agent2 := s.addUser(c, game.Game.GameID)
+	for i, san := range []string{"f3", "e5", "g4", "Qh4#"} {
+		agent := agent1
+		if i%2 == 1 {
+			agent = agent2
+		}
+		s.playSAN(c, agent, san)
+	}
+	var out bytes.Buffer
+	c.Assert(exportCommand(nil, &out), IsNil)
+	c.Assert(out.String(), Matches, `(?s).*\[GameID "`+game.Game.GameID.String()+`"\].*1\. f3 e5 2\. g4 Qh4# 0-1\n\n.*`)
+	out.Reset()
+	c.Assert(exportCommand([]string{game.Game.GameID.String()}, &out), IsNil)
+	c.Assert(strings.Count(out.String(), "[Event "), Equals, 1)
+	c.Assert(exportCommand([]string{"nope"}, &out), NotNil)
+	c.Assert(exportCommand([]string{unknownUUID}, &out), ErrorMatches, "game "+unknownUUID+": record not found")
+}
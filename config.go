@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// config server configuration, read from flags, NKNIGHT_ environment
+// variables and a config file of name = value lines, in that order of
+// precedence.
+type config struct {
+	Addr            string
+	Store           string
+	DSN             string
+	Weights         string
+	MaxIdleConns    int
+	MaxOpenConns    int
+	ConnMaxLifetime time.Duration
+	IdleTimeout     time.Duration
+	AgentGames      int
+	NewAgents       int
+	OpenGames       int
+	NewGames        int
+	LookaheadDepth  int
+}
+
+func defaultConfig() config {
+	return config{
+		Addr:            ":8080",
+		Store:           "postgres",
+		MaxIdleConns:    10,
+		MaxOpenConns:    100,
+		ConnMaxLifetime: time.Hour,
+		IdleTimeout:     30 * time.Second,
+		AgentGames:      5,
+		NewAgents:       3,
+		OpenGames:       10,
+		NewGames:        3,
+		LookaheadDepth:  3,
+	}
+}
+
+var settings = defaultConfig()
+
+func (cfg *config) flags(name string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.StringVar(&cfg.Addr, "addr", cfg.Addr, "address the server listens on")
+	flags.StringVar(&cfg.Store, "store", cfg.Store, "storage backend: postgres, sqlite or sqlite-memory")
+	flags.StringVar(&cfg.DSN, "dsn", cfg.DSN, "postgres connection string or sqlite file path")
+	flags.StringVar(&cfg.Weights, "weights", cfg.Weights, "neural network weight file or directory of versioned weight files")
+	flags.IntVar(&cfg.MaxIdleConns, "max-idle-conns", cfg.MaxIdleConns, "maximum idle database connections")
+	flags.IntVar(&cfg.MaxOpenConns, "max-open-conns", cfg.MaxOpenConns, "maximum open database connections")
+	flags.DurationVar(&cfg.ConnMaxLifetime, "conn-max-lifetime", cfg.ConnMaxLifetime, "maximum time a database connection is reused")
+	flags.DurationVar(&cfg.IdleTimeout, "idle-timeout", cfg.IdleTimeout, "time before the idle loop pokes an agent that has not moved")
+	flags.IntVar(&cfg.AgentGames, "agent-games", cfg.AgentGames, "agent games the idle loop keeps running")
+	flags.IntVar(&cfg.NewAgents, "new-agents", cfg.NewAgents, "agents the idle loop adds to open games at a time")
+	flags.IntVar(&cfg.OpenGames, "open-games", cfg.OpenGames, "open games the idle loop keeps waiting for players")
+	flags.IntVar(&cfg.NewGames, "new-games", cfg.NewGames, "games the idle loop opens at a time")
+	flags.IntVar(&cfg.LookaheadDepth, "lookahead-depth", cfg.LookaheadDepth, "plies of lookahead after each move, 1 to 3")
+	return flags
+}
+
+func envName(name string) string {
+	return "NKNIGHT_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// readConfigFile sets the flags named in the file that are not in explicit.
+func readConfigFile(flags *flag.FlagSet, path string, explicit map[string]bool) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		parts := strings.SplitN(text, "=", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("%s:%d: expected name = value", path, line)
+		}
+		name, value := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		if flags.Lookup(name) == nil || name == "config" {
+			return fmt.Errorf("%s:%d: unknown setting %q", path, line, name)
+		}
+		if explicit[name] {
+			continue
+		}
+		if err := flags.Set(name, value); err != nil {
+			return fmt.Errorf("%s:%d: %s: %w", path, line, name, err)
+		}
+	}
+	return scanner.Err()
+}
+
+func (cfg config) validate() error {
+	if _, _, err := net.SplitHostPort(cfg.Addr); err != nil {
+		return fmt.Errorf("addr %q: %w", cfg.Addr, err)
+	}
+	switch cfg.Store {
+	case "postgres", "sqlite", "sqlite-memory":
+	default:
+		return fmt.Errorf("store %q must be postgres, sqlite or sqlite-memory", cfg.Store)
+	}
+	if cfg.MaxOpenConns < 1 {
+		return errors.New("max-open-conns must be positive")
+	}
+	if cfg.MaxIdleConns < 0 || cfg.MaxIdleConns > cfg.MaxOpenConns {
+		return errors.New("max-idle-conns must be between 0 and max-open-conns")
+	}
+	if cfg.ConnMaxLifetime < 0 {
+		return errors.New("conn-max-lifetime must not be negative")
+	}
+	if cfg.IdleTimeout <= 0 {
+		return errors.New("idle-timeout must be positive")
+	}
+	if cfg.AgentGames < 0 || cfg.NewAgents < 0 || cfg.OpenGames < 0 || cfg.NewGames < 0 {
+		return errors.New("agent-games, new-agents, open-games and new-games must not be negative")
+	}
+	if cfg.LookaheadDepth < 1 || cfg.LookaheadDepth > 3 {
+		return errors.New("lookahead-depth must be between 1 and 3")
+	}
+	return nil
+}
+
+// loadConfig reads the configuration and returns it with the arguments left
+// after the flags.
+func loadConfig(args []string) (config, []string, error) {
+	cfg := defaultConfig()
+	flags := cfg.flags("nknight")
+	path := flags.String("config", "", "config file of name = value lines")
+	if err := flags.Parse(args); err != nil {
+		return cfg, nil, err
+	}
+	explicit := map[string]bool{}
+	flags.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+	if *path == "" {
+		*path = os.Getenv(envName("config"))
+	}
+	if *path != "" {
+		if err := readConfigFile(flags, *path, explicit); err != nil {
+			return cfg, nil, err
+		}
+	}
+	var err error
+	flags.VisitAll(func(f *flag.Flag) {
+		value, ok := os.LookupEnv(envName(f.Name))
+		if !ok || explicit[f.Name] || f.Name == "config" || err != nil {
+			return
+		}
+		if e := flags.Set(f.Name, value); e != nil {
+			err = fmt.Errorf("%s: %w", envName(f.Name), e)
+		}
+	})
+	if err != nil {
+		return cfg, nil, err
+	}
+	if err := cfg.validate(); err != nil {
+		return cfg, nil, fmt.Errorf("invalid config: %w", err)
+	}
+	return cfg, flags.Args(), nil
+}
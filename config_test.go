@@ -0,0 +1,65 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *NKnightSuite) TestLoadConfig(c *C) {
+	cfg, args, err := loadConfig([]string{"perft", "startpos", "2"})
+	c.Assert(err, IsNil)
+	c.Assert(cfg, DeepEquals, defaultConfig())
+	c.Assert(args, DeepEquals, []string{"perft", "startpos", "2"})
+
+	dir, err := os.MkdirTemp("", "nknight")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "nknight.conf")
+	c.Assert(os.WriteFile(path, []byte("# server\naddr = :9090\nstore = sqlite\ndsn = games.db\nidle-timeout = 1m\nagent-games = 7\n"), 0644), IsNil)
+	c.Assert(os.Setenv(envName("agent-games"), "9"), IsNil)
+	c.Assert(os.Setenv(envName("new-games"), "4"), IsNil)
+	defer os.Unsetenv(envName("agent-games"))
+	defer os.Unsetenv(envName("new-games"))
+	cfg, args, err = loadConfig([]string{"-config", path, "-store", "sqlite-memory", "serve"})
+	c.Assert(err, IsNil)
+	c.Assert(args, DeepEquals, []string{"serve"})
+	c.Assert(cfg.Addr, Equals, ":9090")
+	c.Assert(cfg.Store, Equals, "sqlite-memory")
+	c.Assert(cfg.DSN, Equals, "games.db")
+	c.Assert(cfg.IdleTimeout, Equals, time.Minute)
+	c.Assert(cfg.AgentGames, Equals, 9)
+	c.Assert(cfg.NewGames, Equals, 4)
+
+	c.Assert(os.WriteFile(path, []byte("addr = :9090\nports = 2\n"), 0644), IsNil)
+	_, _, err = loadConfig([]string{"-config", path})
+	c.Assert(err, ErrorMatches, `.*nknight.conf:2: unknown setting "ports"`)
+	c.Assert(os.WriteFile(path, []byte("lookahead-depth\n"), 0644), IsNil)
+	_, _, err = loadConfig([]string{"-config", path})
+	c.Assert(err, ErrorMatches, `.*nknight.conf:1: expected name = value`)
+	_, _, err = loadConfig([]string{"-config", filepath.Join(dir, "missing.conf")})
+	c.Assert(err, NotNil)
+
+	c.Assert(os.Setenv(envName("new-games"), "many"), IsNil)
+	_, _, err = loadConfig(nil)
+	c.Assert(err, ErrorMatches, `NKNIGHT_NEW_GAMES: .*`)
+	c.Assert(os.Unsetenv(envName("new-games")), IsNil)
+
+	for _, t := range []struct {
+		args []string
+		err  string
+	}{
+		{[]string{"-addr", "8080"}, `invalid config: addr "8080": .*`},
+		{[]string{"-store", "mongo"}, `invalid config: store "mongo" must be postgres, sqlite or sqlite-memory`},
+		{[]string{"-max-open-conns", "0"}, "invalid config: max-open-conns must be positive"},
+		{[]string{"-max-idle-conns", "200"}, "invalid config: max-idle-conns must be between 0 and max-open-conns"},
+		{[]string{"-idle-timeout", "0s"}, "invalid config: idle-timeout must be positive"},
+		{[]string{"-new-agents", "-1"}, "invalid config: agent-games, new-agents, open-games and new-games must not be negative"},
+		{[]string{"-lookahead-depth", "4"}, "invalid config: lookahead-depth must be between 1 and 3"},
+	} {
+		_, _, err := loadConfig(t.args)
+		c.Assert(err, ErrorMatches, t.err)
+	}
+}
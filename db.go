@@ -2,6 +2,7 @@ package main
 
 import (
 	"errors"
+	"fmt"
 	"net/http"
 	"os"
 	"reflect"
@@ -11,6 +12,7 @@ import (
 	"github.com/apex/log"
 	uuid "github.com/satori/go.uuid"
 	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
 )
@@ -19,53 +21,207 @@ var db *gorm.DB
 
 var placeHolder uuid.UUID
 
+var memoryStores int
+
+// migrations changes the last openStorage made to the schema and data, for
+// the migrate command to report.
+var migrations []string
+
 func init() {
 	placeholder, err := uuid.FromString("f9a87c7e3f4f11eb99b58c8590001d9d")
 	if err != nil {
 		log.WithError(err).Fatal("failed to parse placeholder uuid")
 	}
 	placeHolder = placeholder
+}
 
-	dbname, ok := os.LookupEnv("PGDATABASE")
-	if !ok {
-		dbname = "test"
+// openStorage opens and migrates the configured store: postgres with a
+// connection string defaulting to the PGDATABASE database, sqlite with a
+// file path, or an in-memory sqlite database.
+func openStorage(cfg config) error {
+	var dialector gorm.Dialector
+	dsn := cfg.DSN
+	switch cfg.Store {
+	case "postgres":
+		if dsn == "" {
+			dbname, ok := os.LookupEnv("PGDATABASE")
+			if !ok {
+				dbname = "test"
+			}
+			dsn = strings.Join([]string{"dbname", dbname}, "=")
+		}
+		dialector = postgres.Open(dsn)
+	case "sqlite":
+		if dsn == "" {
+			dsn = "nknight.db"
+		}
+		dialector = sqlite.Open(dsn)
+	case "sqlite-memory":
+		memoryStores = memoryStores + 1
+		dialector = sqlite.Open(fmt.Sprintf("file:nknight%d?mode=memory&cache=shared", memoryStores))
+	default:
+		return fmt.Errorf("unknown store %q", cfg.Store)
 	}
-	connStr := strings.Join([]string{"dbname", dbname}, "=")
 
-	database, err := gorm.Open(postgres.Open(connStr), &gorm.Config{
+	database, err := gorm.Open(dialector, &gorm.Config{
 		Logger:      logger.Default.LogMode(logger.Silent),
 		QueryFields: true,
 	})
 	if err != nil {
-		log.WithError(err).WithField("connStr", connStr).Fatal("failed to connect database")
+		return err
 	}
 
 	sqlDB, err := database.DB()
 	if err != nil {
-		log.WithError(err).Fatal("error")
+		return err
 	}
 
 	// SetMaxIdleConns sets the maximum number of connections in the idle connection pool.
-	sqlDB.SetMaxIdleConns(10)
+	sqlDB.SetMaxIdleConns(cfg.MaxIdleConns)
 	// SetMaxOpenConns sets the maximum number of open connections to the database.
-	sqlDB.SetMaxOpenConns(100)
+	sqlDB.SetMaxOpenConns(cfg.MaxOpenConns)
 	// SetConnMaxLifetime sets the maximum amount of time a connection may be reused.
-	sqlDB.SetConnMaxLifetime(time.Hour)
+	sqlDB.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	if cfg.Store == "sqlite-memory" {
+		// The in-memory database lives as long as one connection stays open.
+		sqlDB.SetConnMaxLifetime(0)
+		// Shared cache connections fail with "table is locked" rather than
+		// wait for each other, so concurrent games share one connection.
+		sqlDB.SetMaxOpenConns(1)
+	}
 
-	database.AutoMigrate(&Board{}, &Game{})
-	if err := database.Error; err != nil {
-		log.WithError(err).Fatal("error")
+	if err := database.SetupJoinTable(&Board{}, "Children", &GamePlay{}); err != nil {
+		return err
+	}
+	migrations = nil
+	if err := migrateGameResults(database); err != nil {
+		return err
+	}
+	pending, err := pendingSchema(database, &Board{}, &GamePlay{}, &Game{}, &Position{}, &Player{}, &Rating{})
+	if err != nil {
+		return err
+	}
+	if err := database.AutoMigrate(&Board{}, &Game{}, &Position{}, &Player{}, &Rating{}); err != nil {
+		return err
+	}
+	migrations = append(migrations, pending...)
+	if err := resetLegacyBoards(database); err != nil {
+		return err
+	}
+	if err := backfillHashes(database); err != nil {
+		return err
 	}
 
 	db = database
+	store = gormStore{db: database}
+	return nil
+}
+
+// pendingSchema lists the tables and columns AutoMigrate is about to add for
+// the models.
+func pendingSchema(database *gorm.DB, models ...interface{}) ([]string, error) {
+	migrator := database.Migrator()
+	var changes []string
+	for _, model := range models {
+		stmt := &gorm.Statement{DB: database}
+		if err := stmt.Parse(model); err != nil {
+			return nil, err
+		}
+		if !migrator.HasTable(model) {
+			changes = append(changes, "created table "+stmt.Schema.Table)
+			continue
+		}
+		for _, name := range stmt.Schema.DBNames {
+			if !migrator.HasColumn(model, name) {
+				changes = append(changes, fmt.Sprintf("added column %s.%s", stmt.Schema.Table, name))
+			}
+		}
+	}
+	return changes, nil
+}
+
+// migrateGameResults replaces the boolean end column of games with the
+// result column. Games that had ended get resultUnknown as their result was
+// never stored.
+func migrateGameResults(database *gorm.DB) error {
+	migrator := database.Migrator()
+	if !migrator.HasTable(&Game{}) || !migrator.HasColumn(&Game{}, "end") {
+		return nil
+	}
+	if !migrator.HasColumn(&Game{}, "result") {
+		if err := migrator.AddColumn(&Game{}, "End"); err != nil {
+			return err
+		}
+	}
+	if err := database.Exec(`UPDATE games SET result = ? WHERE "end" = ? AND (result IS NULL OR result = ?)`, resultUnknown, true, resultNone).Error; err != nil {
+		return err
+	}
+	if err := database.Exec("UPDATE games SET result = ? WHERE result IS NULL", resultNone).Error; err != nil {
+		return err
+	}
+	if err := migrator.DropColumn(&Game{}, "end"); err != nil {
+		return err
+	}
+	migrations = append(migrations, "replaced games.end with games.result")
+	return nil
+}
+
+// legacyEncoding reports a board stored before boards carried color,
+// castling and en passant flags, which never marks a square purple.
+func (board chessState) legacyEncoding() bool {
+	for _, piece := range board {
+		if piece&purpleFlag != 0 {
+			return false
+		}
+	}
+	return true
+}
 
-	// board, err := makeBoard(&initialBoard)
-	// if err != nil {
-	// 	log.WithError(err).Fatal("error")
-	// }
-	// if err := board.lookahead(true); err != nil {
-	// 	log.WithError(err).Fatal("error")
-	// }
+// resetLegacyBoards clears the board graph and its games when the oldest
+// board uses the legacy encoding. Those boards cannot be re-encoded as they
+// never recorded the side to move or castling rights, and no current board
+// compares equal to them.
+func resetLegacyBoards(database *gorm.DB) error {
+	var boards []Board
+	if err := database.Order("id").Limit(1).Find(&boards).Error; err != nil {
+		return err
+	}
+	if len(boards) == 0 || !boards[0].Board.legacyEncoding() {
+		return nil
+	}
+	log.Warn("resetting boards and games stored in the legacy board encoding")
+	if err := database.Transaction(func(tx *gorm.DB) error {
+		for _, table := range []string{"positions", "games", "game_play", "boards"} {
+			if err := tx.Exec("DELETE FROM " + table).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	migrations = append(migrations, "reset boards and games stored in the legacy board encoding")
+	return nil
+}
+
+// backfillHashes hashes boards stored before the hash column existed.
+func backfillHashes(database *gorm.DB) error {
+	var boards []Board
+	result := database.Where("hash = ?", 0).FindInBatches(&boards, 1000, func(tx *gorm.DB, batch int) error {
+		for _, board := range boards {
+			if err := tx.Exec("UPDATE boards SET hash = ? WHERE id = ?", int64(board.Board.zobrist()), board.ID).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		migrations = append(migrations, fmt.Sprintf("hashed %d boards", result.RowsAffected))
+	}
+	return nil
 }
 
 func idleError(message string, err error) {
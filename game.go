@@ -1,73 +1,127 @@
 package main
 
 import (
+	"fmt"
 	"net/http"
 
 	"github.com/labstack/echo/v4"
 	uuid "github.com/satori/go.uuid"
 	"gorm.io/gorm"
-	"gorm.io/gorm/clause"
 )
 
 // Game game.
 type Game struct {
 	gorm.Model
 
-	ActiveAgent       uuid.UUID `gorm:"type:varchar;size:20;index"`
-	ActiveAgentPurple bool
-	ActiveAgentType   string
-	BoardID           uint
-	Board             Board
-	End               bool
-	GameID            uuid.UUID `gorm:"<-:create;type:varchar;size:20;uniqueIndex"`
-	InactiveAgent     uuid.UUID `gorm:"type:varchar;size:20;index"`
-	InactiveAgentType string
-	MoveCount         int
-	MovesSincePawn    int
+	ActiveAgent           uuid.UUID `gorm:"type:varchar;size:20;index"`
+	ActiveAgentDepth      int
+	ActiveAgentMoveTime   int
+	ActiveAgentName       string
+	ActiveAgentPlayouts   int
+	ActiveAgentPurple     bool
+	ActiveAgentType       string
+	BoardID               uint
+	Board                 Board
+	End                   gameResult `gorm:"column:result"`
+	FEN                   string     `gorm:"-"`
+	GameID                uuid.UUID  `gorm:"<-:create;type:varchar;size:20;uniqueIndex"`
+	InactiveAgent         uuid.UUID  `gorm:"type:varchar;size:20;index"`
+	InactiveAgentDepth    int
+	InactiveAgentMoveTime int
+	InactiveAgentName     string
+	InactiveAgentPlayouts int
+	InactiveAgentType     string
+	MoveCount             int
+	MovesSincePawn        int
+	Termination           string
+}
+
+// Position position.
+type Position struct {
+	gorm.Model
+
+	BoardID        uint
+	Board          Board
+	GameID         uuid.UUID `gorm:"type:varchar;size:20;index"`
+	MovesSincePawn int
+	Ply            int
 }
 
 func gameIdle() error {
-	var count int64
-	if err := db.Model(&Game{}).Where(Game{InactiveAgent: placeHolder}).Count(&count).Error; err != nil {
+	count, err := store.countOpenGames()
+	if err != nil {
 		return err
 	}
-	if count < 10 {
-		for i := 0; i < 3; i++ {
-			game, err := makeGame()
+	if count < int64(settings.OpenGames) {
+		for i := 0; i < settings.NewGames; i++ {
+			game, err := makeGame("")
 			if err != nil {
 				return err
 			}
-			if _, err := game.makeAgent("agent"); err != nil {
+			if _, err := game.makeAgent("agent", "", 0, 0, 0); err != nil {
 				return err
 			}
 		}
 	}
-	return db.Where(Game{End: true}).Not(Game{ActiveAgentType: "user"}).Not(Game{InactiveAgentType: "user"}).Delete(&Game{}).Error
+	return store.deleteFinishedGames()
 }
 
-func makeGame() (*Game, error) {
-	board, err := getBoardByBoard(initialBoard)
+func makeGame(fen string) (*Game, error) {
+	state, halfmove, fullmove := initialBoard, 0, 1
+	if fen != "" {
+		var err error
+		state, halfmove, fullmove, err = parseFEN(fen)
+		if err != nil {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+	}
+	if _, err := makeBoard(state); err != nil {
+		return nil, err
+	}
+	board, err := getBoardByBoard(state)
 	if err != nil {
 		return nil, err
 	}
+	isPurple := state.activePurple()
+	if len(board.Children) == 0 {
+		if err := board.lookahead(isPurple); err != nil {
+			return nil, err
+		}
+	}
+	moveCount := (fullmove - 1) * 2
+	if !isPurple {
+		moveCount = moveCount + 1
+	}
 	id := uuid.NewV4()
-	if err := db.Create(&Game{GameID: id, Board: board, ActiveAgent: placeHolder, ActiveAgentPurple: true, InactiveAgent: placeHolder}).Error; err != nil {
+	game := Game{GameID: id, Board: board, ActiveAgent: placeHolder, ActiveAgentPurple: isPurple, InactiveAgent: placeHolder, MoveCount: moveCount, MovesSincePawn: halfmove}
+	if err := store.createGame(&game); err != nil {
+		return nil, err
+	}
+	if err := game.addPosition(); err != nil {
 		return nil, err
 	}
 	return getGame(id)
 }
 
+func getGameUnscoped(id uuid.UUID) (*Game, error) {
+	return store.getGameUnscoped(id)
+}
+
+func (game Game) addPosition() error {
+	return store.addPosition(&Position{GameID: game.GameID, BoardID: game.Board.ID, MovesSincePawn: game.MovesSincePawn, Ply: game.MoveCount})
+}
+
+func (game Game) getPositions() ([]Position, error) {
+	return store.getPositions(game.GameID)
+}
+
 func getGame(id uuid.UUID) (*Game, error) {
-	var game Game
-	if err := db.Preload(clause.Associations).First(&game, Game{GameID: id}).Error; err != nil {
-		return nil, err
-	}
-	return &game, nil
+	return store.getGame(id)
 }
 
 func getGames() ([]Game, error) {
-	var games []Game
-	if err := db.Where(Game{InactiveAgent: placeHolder}).Find(&games).Error; err != nil {
+	games, err := store.openGames()
+	if err != nil {
 		return nil, err
 	}
 	for _, game := range games {
@@ -77,7 +131,8 @@ func getGames() ([]Game, error) {
 }
 
 func (game Game) response(agentID uuid.UUID) Game {
-	if !game.End {
+	game.FEN = game.Board.Board.FEN(game.MovesSincePawn, game.MoveCount/2+1)
+	if game.End == resultNone {
 		if !uuid.Equal(game.ActiveAgent, agentID) {
 			game.ActiveAgent = uuid.Nil
 		}
@@ -88,18 +143,46 @@ func (game Game) response(agentID uuid.UUID) Game {
 	return game
 }
 
-func (game *Game) addAgent(id uuid.UUID, agentType string) error {
+// addAgent seats the agent. Depth is the search depth in plies of the
+// alphabeta and neural agents, playouts the iterations per move of the mcts
+// agent and moveTime the milliseconds either may search, zero meaning the
+// agent default.
+func (game *Game) addAgent(id uuid.UUID, agentType, name string, depth, playouts, moveTime int) error {
 	if !uuid.Equal(placeHolder, game.InactiveAgent) {
 		return echo.NewHTTPError(http.StatusBadRequest, "game is full")
 	}
+	if !validAgentType(agentType) {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("unknown agent type %q", agentType))
+	}
+	if depth < 0 || playouts < 0 || moveTime < 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "depth, playouts and move time must not be negative")
+	}
+	if playouts != 0 && agentType != "mcts" {
+		return echo.NewHTTPError(http.StatusBadRequest, "playouts only apply to mcts agents")
+	}
+	if depth != 0 && agentType == "mcts" {
+		return echo.NewHTTPError(http.StatusBadRequest, "mcts agents take playouts instead of depth")
+	}
+	player, err := playerName(agentType, name)
+	if err != nil {
+		return err
+	}
 	if uuid.Equal(placeHolder, game.ActiveAgent) {
 		game.ActiveAgent = id
 		game.ActiveAgentType = agentType
+		game.ActiveAgentDepth = depth
+		game.ActiveAgentPlayouts = playouts
+		game.ActiveAgentMoveTime = moveTime
+		game.ActiveAgentName = player
 	} else {
 		game.InactiveAgent = id
 		game.InactiveAgentType = agentType
+		game.InactiveAgentDepth = depth
+		game.InactiveAgentPlayouts = playouts
+		game.InactiveAgentMoveTime = moveTime
+		game.InactiveAgentName = player
 	}
-	if err := db.Save(&game).Error; err != nil {
+	if err := store.saveGame(game); err != nil {
 		return err
 	}
 	if !uuid.Equal(placeHolder, game.InactiveAgent) {
@@ -124,23 +207,30 @@ func (game Game) getPlays() ([]chessState, []move, error) {
 	for _, child := range board.Children {
 		boards = append(boards, child.Board)
 	}
-	moves := make([]move, 0, len(boards))
-	for move := range game.Board.Board.movesForBoard(game.ActiveAgentPurple) {
-		moves = append(moves, move)
-	}
-	return boards, moves, nil
+	return boards, game.Board.Board.moveList(game.ActiveAgentPurple), nil
 }
 
 func (game Game) moveToBoard(m move) *chessState {
-	moves := make(chan move)
-	moves <- m
-	close(moves)
-	var board chessState
-	for board = range game.Board.Board.movesToBoards(moves, game.ActiveAgentPurple) {
-	}
+	board := game.Board.Board.moveToBoard(m, game.ActiveAgentPurple).swap()
 	return &board
 }
 
+func (game Game) sanToBoard(san string) (*chessState, error) {
+	m, err := game.Board.Board.parseSAN(san, game.Board.Board.moveList(game.ActiveAgentPurple))
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	return game.moveToBoard(m), nil
+}
+
+func (game Game) uciToBoard(uci string) (*chessState, error) {
+	m, err := parseUCI(uci, game.Board.Board.moveList(game.ActiveAgentPurple), game.ActiveAgentPurple)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	return game.moveToBoard(m), nil
+}
+
 func (game *Game) validMove(state chessState) (bool, error) {
 	board, err := getBoard(game.BoardID)
 	if err != nil {
@@ -150,24 +240,11 @@ func (game *Game) validMove(state chessState) (bool, error) {
 	if err != nil {
 		return false, err
 	}
-	var count int64
-	if err := db.Table("game_play").Where("board_id", board.ID).Where("child_id", child.ID).Count(&count).Error; err != nil {
-		return false, err
-	}
-	if count != 1 {
-		return false, nil
-	}
-	for pos, piece := range child.Board {
-		if piece&0xF == pawn|1 && board.Board[pos]&0xF != pawn|1 {
-			game.MovesSincePawn = 0
-			return true, nil
-		}
-	}
-	return true, nil
+	return store.hasPlay(board.ID, child.ID)
 }
 
 func (game *Game) putBoard(state chessState) error {
-	if game.End {
+	if game.End != resultNone {
 		return echo.NewHTTPError(http.StatusBadRequest, "game is over")
 	}
 	if valid, err := game.validMove(state); !valid {
@@ -180,30 +257,43 @@ func (game *Game) putBoard(state chessState) error {
 	if err != nil {
 		return err
 	}
+	if game.Board.Board.resetsClock(state) {
+		game.MovesSincePawn = 0
+	} else {
+		game.MovesSincePawn = game.MovesSincePawn + 1
+	}
 	game.InactiveAgent, game.ActiveAgent = game.ActiveAgent, game.InactiveAgent
 	game.InactiveAgentType, game.ActiveAgentType = game.ActiveAgentType, game.InactiveAgentType
+	game.InactiveAgentDepth, game.ActiveAgentDepth = game.ActiveAgentDepth, game.InactiveAgentDepth
+	game.InactiveAgentPlayouts, game.ActiveAgentPlayouts = game.ActiveAgentPlayouts, game.InactiveAgentPlayouts
+	game.InactiveAgentMoveTime, game.ActiveAgentMoveTime = game.ActiveAgentMoveTime, game.InactiveAgentMoveTime
+	game.InactiveAgentName, game.ActiveAgentName = game.ActiveAgentName, game.InactiveAgentName
 	game.ActiveAgentPurple = !game.ActiveAgentPurple
 	game.MoveCount = game.MoveCount + 1
-	game.MovesSincePawn = game.MovesSincePawn + 1
 	game.Board = board
-	game.End = game.MoveCount > 4048 || game.MovesSincePawn > 50 || board.end()
-	if game.End {
-		if board.end() {
-			board.ActiveScore = 3
-			board.InactiveScore = -2
-		} else {
-			board.ActiveScore = 1
-			board.InactiveScore = 1
+	if err := game.addPosition(); err != nil {
+		return err
+	}
+	game.End, game.Termination = board.Board.outcome()
+	if game.End != resultNone {
+		// Only outcomes of the position itself score the board every game
+		// shares; draws by the history of this game end the game alone.
+		if err := board.terminal(game.End); err != nil {
+			return err
 		}
-		if err := db.Save(&board).Error; err != nil {
+	} else if err := game.drawRules(); err != nil {
+		return err
+	}
+	if game.End != resultNone {
+		if err := game.finish(); err != nil {
 			return err
 		}
 	} else {
-		if err := board.lookahead3(game.ActiveAgentPurple); err != nil {
+		if err := board.lookaheadDepth(game.ActiveAgentPurple, settings.LookaheadDepth, nil); err != nil {
 			return err
 		}
 	}
-	if err := db.Save(&game).Error; err != nil {
+	if err := store.saveGame(game); err != nil {
 		return err
 	}
 	if game.InactiveAgentType == game.ActiveAgentType {
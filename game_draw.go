@@ -0,0 +1,112 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	uuid "github.com/satori/go.uuid"
+)
+
+func (board chessState) insufficientMaterial() bool {
+	minors := 0
+	bishopColors := [2]int{}
+	for pos, piece := range board {
+		switch piece & 0xE {
+		case pawn, queen, rook:
+			return false
+		case knight:
+			minors = minors + 1
+		case bishop:
+			minors = minors + 1
+			bishopColors[(pos/8+pos%8)%2]++
+		}
+	}
+	return minors <= 1 || bishopColors[0] == minors || bishopColors[1] == minors
+}
+
+func (board chessState) resetsClock(next chessState) bool {
+	pieces := 0
+	nextPieces := 0
+	for pos := range board {
+		if board[pos]&0xF == pawn|1 && next[pos]&0xF != pawn {
+			return true
+		}
+		if board[pos]&0xE != 0 {
+			pieces = pieces + 1
+		}
+		if next[pos]&0xE != 0 {
+			nextPieces = nextPieces + 1
+		}
+	}
+	return nextPieces < pieces
+}
+
+func (game Game) repetitions() (int64, error) {
+	return store.countRepetitions(game.GameID, game.Board.ID, game.MoveCount-game.MovesSincePawn)
+}
+
+func (game Game) automaticDraw() (string, error) {
+	repetitions, err := game.repetitions()
+	if err != nil {
+		return "", err
+	}
+	if repetitions >= 5 {
+		return "fivefold repetition", nil
+	}
+	return "", nil
+}
+
+func (game Game) claimableDraw() (string, error) {
+	repetitions, err := game.repetitions()
+	if err != nil {
+		return "", err
+	}
+	if repetitions >= 3 {
+		return "threefold repetition", nil
+	}
+	if game.MovesSincePawn >= 100 {
+		return "fifty-move rule", nil
+	}
+	return "", nil
+}
+
+func (game *Game) claimDraw(id uuid.UUID) error {
+	if !uuid.Equal(id, game.ActiveAgent) {
+		return echo.NewHTTPError(http.StatusNotAcceptable, "not your turn")
+	}
+	if game.End != resultNone {
+		return echo.NewHTTPError(http.StatusBadRequest, "game is over")
+	}
+	termination, err := game.claimableDraw()
+	if err != nil {
+		return err
+	}
+	if termination == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "no draw to claim")
+	}
+	game.End, game.Termination = resultDraw, termination
+	if err := game.finish(); err != nil {
+		return err
+	}
+	return store.saveGame(game)
+}
+
+func (game *Game) drawRules() error {
+	termination, err := game.automaticDraw()
+	if err != nil {
+		return err
+	}
+	if termination == "" && game.ActiveAgentType != "user" {
+		termination, err = game.claimableDraw()
+		if err != nil {
+			return err
+		}
+	}
+	if termination == "" && game.MoveCount > 4048 {
+		termination = "move limit"
+	}
+	if termination != "" {
+		game.End, game.Termination = resultDraw, termination
+	}
+	return nil
+}
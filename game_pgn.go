@@ -0,0 +1,295 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+func agentName(agentType string) string {
+	if agentType == "" {
+		return "?"
+	}
+	return agentType
+}
+
+// pgnPlayer names a side by its rating player, falling back to its type.
+func pgnPlayer(name, agentType string) string {
+	if name != "" {
+		return name
+	}
+	return agentName(agentType)
+}
+
+// pgnTag formats a tag pair, escaping quotes and backslashes in its value.
+func pgnTag(name, value string) string {
+	value = strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value)
+	return fmt.Sprintf("[%s \"%s\"]\n", name, value)
+}
+
+func (game Game) pgnMoves(positions []Position) ([]string, error) {
+	tokens := make([]string, 0, len(positions)*3/2+1)
+	for i := 1; i < len(positions); i++ {
+		board := positions[i-1].Board.Board
+		isPurple := board.activePurple()
+		moves := board.moveList(isPurple)
+		m, ok := board.findMove(moves, positions[i].Board.Board, isPurple)
+		if !ok {
+			return nil, fmt.Errorf("no move from ply %d to ply %d", positions[i-1].Ply, positions[i].Ply)
+		}
+		if isPurple {
+			tokens = append(tokens, fmt.Sprintf("%d.", positions[i-1].Ply/2+1))
+		} else if i == 1 {
+			tokens = append(tokens, fmt.Sprintf("%d...", positions[i-1].Ply/2+1))
+		}
+		tokens = append(tokens, board.san(m, moves, isPurple))
+	}
+	return tokens, nil
+}
+
+func (game Game) pgn() (string, error) {
+	positions, err := game.getPositions()
+	if err != nil {
+		return "", err
+	}
+	white, black := pgnPlayer(game.ActiveAgentName, game.ActiveAgentType), pgnPlayer(game.InactiveAgentName, game.InactiveAgentType)
+	if !game.ActiveAgentPurple {
+		white, black = black, white
+	}
+	result := game.End.String()
+	var pgn strings.Builder
+	pgn.WriteString(pgnTag("Event", "nknight"))
+	pgn.WriteString(pgnTag("Site", "nknight"))
+	pgn.WriteString(pgnTag("Date", game.CreatedAt.Format("2006.01.02")))
+	pgn.WriteString(pgnTag("Round", "-"))
+	pgn.WriteString(pgnTag("White", white))
+	pgn.WriteString(pgnTag("Black", black))
+	pgn.WriteString(pgnTag("Result", result))
+	pgn.WriteString(pgnTag("GameID", game.GameID.String()))
+	if len(positions) > 0 {
+		start := positions[0]
+		if start.Board.Board != initialBoard || start.Ply != 0 {
+			pgn.WriteString(pgnTag("SetUp", "1"))
+			pgn.WriteString(pgnTag("FEN", start.Board.Board.FEN(start.MovesSincePawn, start.Ply/2+1)))
+		}
+	}
+	pgn.WriteString("\n")
+	tokens, err := game.pgnMoves(positions)
+	if err != nil {
+		return "", err
+	}
+	line := 0
+	for _, token := range append(tokens, result) {
+		if line > 0 && line+1+len(token) > 79 {
+			pgn.WriteString("\n")
+			line = 0
+		} else if line > 0 {
+			pgn.WriteString(" ")
+			line = line + 1
+		}
+		pgn.WriteString(token)
+		line = line + len(token)
+	}
+	pgn.WriteString("\n\n")
+	return pgn.String(), nil
+}
+
+// exportCommand prints the games with the given ids, or every finished game,
+// as PGN.
+func exportCommand(args []string, out io.Writer) error {
+	games := make([]*Game, 0, len(args))
+	if len(args) == 0 {
+		finished, err := store.finishedGames()
+		if err != nil {
+			return err
+		}
+		for i := range finished {
+			games = append(games, &finished[i])
+		}
+	}
+	for _, arg := range args {
+		id, err := uuid.FromString(arg)
+		if err != nil {
+			return err
+		}
+		game, err := getGameUnscoped(id)
+		if err != nil {
+			return fmt.Errorf("game %s: %w", arg, err)
+		}
+		games = append(games, game)
+	}
+	for _, game := range games {
+		pgn, err := game.pgn()
+		if err != nil {
+			return fmt.Errorf("game %s: %w", game.GameID, err)
+		}
+		if _, err := io.WriteString(out, pgn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type pgnGame struct {
+	Tags   map[string]string
+	Moves  []string
+	Result string
+}
+
+func isPGNResult(token string) bool {
+	return token == "1-0" || token == "0-1" || token == "1/2-1/2" || token == "*"
+}
+
+func readPGNTag(reader *bufio.Reader) (string, string, error) {
+	line, err := reader.ReadString(']')
+	if err != nil {
+		return "", "", fmt.Errorf("unterminated tag: %w", err)
+	}
+	line = strings.TrimSpace(strings.TrimSuffix(line, "]"))
+	fields := strings.SplitN(line, " ", 2)
+	if len(fields) != 2 {
+		return "", "", fmt.Errorf("invalid tag %q", line)
+	}
+	value, err := strconv.Unquote(strings.TrimSpace(fields[1]))
+	if err != nil {
+		return "", "", fmt.Errorf("invalid tag value %q: %w", fields[1], err)
+	}
+	return fields[0], value, nil
+}
+
+func readPGNToken(reader *bufio.Reader) (string, error) {
+	var token strings.Builder
+	for {
+		r, _, err := reader.ReadRune()
+		if err == io.EOF {
+			return token.String(), nil
+		} else if err != nil {
+			return "", err
+		}
+		if unicode.IsSpace(r) || strings.ContainsRune("[]{}();$", r) {
+			return token.String(), reader.UnreadRune()
+		}
+		token.WriteRune(r)
+	}
+}
+
+func parsePGN(r io.Reader) ([]pgnGame, error) {
+	reader := bufio.NewReader(r)
+	games := make([]pgnGame, 0, 1)
+	game := pgnGame{Tags: map[string]string{}}
+	started := false
+	depth := 0
+	lineStart := true
+	finish := func(result string) {
+		game.Result = result
+		games = append(games, game)
+		game = pgnGame{Tags: map[string]string{}}
+		started = false
+	}
+	for {
+		r, _, err := reader.ReadRune()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		atLineStart := lineStart
+		lineStart = r == '\n'
+		switch {
+		case unicode.IsSpace(r):
+		case r == '%' && atLineStart, r == ';':
+			if _, err := reader.ReadString('\n'); err != nil && err != io.EOF {
+				return nil, err
+			}
+			lineStart = true
+		case r == '{':
+			if _, err := reader.ReadString('}'); err != nil {
+				return nil, fmt.Errorf("unterminated comment: %w", err)
+			}
+		case r == '(':
+			depth = depth + 1
+		case r == ')':
+			if depth == 0 {
+				return nil, errors.New("unbalanced variation")
+			}
+			depth = depth - 1
+		case r == '$':
+			if _, err := readPGNToken(reader); err != nil {
+				return nil, err
+			}
+		case r == '[':
+			if started {
+				finish("*")
+			}
+			name, value, err := readPGNTag(reader)
+			if err != nil {
+				return nil, err
+			}
+			game.Tags[name] = value
+		default:
+			if err := reader.UnreadRune(); err != nil {
+				return nil, err
+			}
+			token, err := readPGNToken(reader)
+			if err != nil {
+				return nil, err
+			}
+			if token == "" {
+				if _, _, err := reader.ReadRune(); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			if depth > 0 {
+				continue
+			}
+			started = true
+			if isPGNResult(token) {
+				finish(token)
+				continue
+			}
+			digits := strings.IndexFunc(token, func(r rune) bool { return r < '0' || r > '9' })
+			if digits > 0 && token[digits] == '.' {
+				token = strings.TrimLeft(token[digits:], ".")
+			}
+			if token != "" {
+				game.Moves = append(game.Moves, token)
+			}
+		}
+	}
+	if depth > 0 {
+		return nil, errors.New("unbalanced variation")
+	}
+	if started || len(game.Tags) > 0 {
+		finish("*")
+	}
+	return games, nil
+}
+
+func (game pgnGame) replay() ([]chessState, error) {
+	state, _, _, err := parseFEN(initialFEN)
+	if fen, ok := game.Tags["FEN"]; ok {
+		state, _, _, err = parseFEN(fen)
+	}
+	if err != nil {
+		return nil, err
+	}
+	states := make([]chessState, 0, len(game.Moves)+1)
+	states = append(states, state)
+	for _, san := range game.Moves {
+		isPurple := state.activePurple()
+		m, err := state.parseSAN(san, state.moveList(isPurple))
+		if err != nil {
+			return nil, err
+		}
+		state = state.moveToBoard(m, isPurple).swap()
+		states = append(states, state)
+	}
+	return states, nil
+}
@@ -0,0 +1,381 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+const selfplayPoll = 20 * time.Millisecond
+
+// selfplayAgent agent type with its player name and search settings.
+type selfplayAgent struct {
+	Type     string
+	Name     string
+	Depth    int
+	Playouts int
+	MoveTime int
+}
+
+// selfplayMatch games between two agents, alternating colours unless fixed.
+type selfplayMatch struct {
+	agents      [2]selfplayAgent
+	games       int
+	workers     int
+	openings    []string
+	randomPlies int
+	alternate   bool
+	seed        int64
+}
+
+// selfplayResult finished game with the index of the agent playing white.
+type selfplayResult struct {
+	index  int
+	purple int
+	game   *Game
+	pgn    string
+}
+
+// selfplayGame plays one game between the agents from the position and
+// returns it once finished, poking agents that stall like the idle loop.
+func selfplayGame(fen string, purple, green selfplayAgent) (*Game, error) {
+	game, err := makeGame(fen)
+	if err != nil {
+		return nil, err
+	}
+	first, second := purple, green
+	if !game.ActiveAgentPurple {
+		first, second = green, purple
+	}
+	if _, err := game.makeAgent(first.Type, first.Name, first.Depth, first.Playouts, first.MoveTime); err != nil {
+		return nil, err
+	}
+	if _, err := game.makeAgent(second.Type, second.Name, second.Depth, second.Playouts, second.MoveTime); err != nil {
+		return nil, err
+	}
+	for {
+		current, err := getGameUnscoped(game.GameID)
+		if err != nil {
+			return nil, err
+		}
+		if current.End != resultNone {
+			return current, nil
+		}
+		if time.Since(current.UpdatedAt) > settings.IdleTimeout {
+			if err := current.pokeAgent(); err != nil {
+				return nil, err
+			}
+		}
+		time.Sleep(selfplayPoll)
+	}
+}
+
+// readOpenings reads one FEN or four field EPD position per line, skipping
+// blank lines and # comments.
+func readOpenings(r io.Reader) ([]string, error) {
+	openings := []string{}
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) > 4 {
+			// EPD operations follow the position where FEN has its clocks.
+			if _, err := strconv.Atoi(fields[4]); err != nil {
+				fields = fields[:4]
+			}
+		}
+		if len(fields) == 4 {
+			fields = append(fields, "0", "1")
+		}
+		fen := strings.Join(fields, " ")
+		if _, _, _, err := parseFEN(fen); err != nil {
+			return nil, fmt.Errorf("opening line %d: %w", line, err)
+		}
+		openings = append(openings, fen)
+	}
+	return openings, scanner.Err()
+}
+
+// opening starting position of a game: the book position in turn, then
+// random plies seeded by the game so matches can be replayed.
+func (match selfplayMatch) opening(index int) (string, error) {
+	fen := initialFEN
+	if len(match.openings) > 0 {
+		fen = match.openings[index%len(match.openings)]
+	}
+	if match.randomPlies == 0 {
+		return fen, nil
+	}
+	board, halfmove, fullmove, err := parseFEN(fen)
+	if err != nil {
+		return "", err
+	}
+	random := rand.New(rand.NewSource(match.seed + int64(index)))
+	for ply := 0; ply < match.randomPlies; ply++ {
+		isPurple := board.activePurple()
+		moves := board.moveList(isPurple)
+		if len(moves) == 0 {
+			break
+		}
+		next := board.moveToBoard(moves[random.Intn(len(moves))], isPurple).swap()
+		if len(next.moveList(!isPurple)) == 0 {
+			break
+		}
+		halfmove = halfmove + 1
+		if board.resetsClock(next) {
+			halfmove = 0
+		}
+		if !isPurple {
+			fullmove = fullmove + 1
+		}
+		board = next
+	}
+	return board.FEN(halfmove, fullmove), nil
+}
+
+func (match selfplayMatch) play(index int) (selfplayResult, error) {
+	fen, err := match.opening(index)
+	if err != nil {
+		return selfplayResult{}, err
+	}
+	purple := 0
+	if match.alternate && index%2 == 1 {
+		purple = 1
+	}
+	game, err := selfplayGame(fen, match.agents[purple], match.agents[1-purple])
+	if err != nil {
+		return selfplayResult{}, fmt.Errorf("game %d: %w", index+1, err)
+	}
+	pgn, err := game.pgn()
+	if err != nil {
+		return selfplayResult{}, fmt.Errorf("game %d: %w", index+1, err)
+	}
+	return selfplayResult{index: index, purple: purple, game: game, pgn: pgn}, nil
+}
+
+// run plays the games on the workers and returns the results in game order.
+func (match selfplayMatch) run() ([]selfplayResult, error) {
+	results := make([]selfplayResult, match.games)
+	indexes := make(chan int)
+	errs := make(chan error, match.workers)
+	var wg sync.WaitGroup
+	for w := 0; w < match.workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range indexes {
+				result, err := match.play(index)
+				if err != nil {
+					errs <- err
+					for range indexes {
+					}
+					return
+				}
+				results[index] = result
+			}
+		}()
+	}
+	for index := 0; index < match.games; index++ {
+		indexes <- index
+	}
+	close(indexes)
+	wg.Wait()
+	close(errs)
+	if err := <-errs; err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// agentNames names the agents by player name or type, numbering them when
+// the names match.
+func (match selfplayMatch) agentNames() [2]string {
+	var names [2]string
+	for i, agent := range match.agents {
+		names[i] = agent.Name
+		if names[i] == "" {
+			names[i] = agent.Type
+		}
+	}
+	if names[0] == names[1] {
+		names[0], names[1] = names[0]+" 1", names[1]+" 2"
+	}
+	return names
+}
+
+// writeSummary writes wins, draws and losses of each agent; unfinished games
+// count as neither.
+func (match selfplayMatch) writeSummary(w io.Writer, results []selfplayResult) error {
+	var wins, draws, losses [2]int
+	for _, result := range results {
+		for agent := range match.agents {
+			switch result.game.End {
+			case resultDraw:
+				draws[agent] = draws[agent] + 1
+			case winner(result.purple == agent):
+				wins[agent] = wins[agent] + 1
+			case winner(result.purple != agent):
+				losses[agent] = losses[agent] + 1
+			}
+		}
+	}
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(table, "Agent\tGames\tWins\tDraws\tLosses\tScore\t")
+	for agent, name := range match.agentNames() {
+		score := float64(wins[agent]) + float64(draws[agent])/2
+		fmt.Fprintf(table, "%s\t%d\t%d\t%d\t%d\t%.1f\t\n", name, len(results), wins[agent], draws[agent], losses[agent], score)
+	}
+	return table.Flush()
+}
+
+func (match selfplayMatch) writeResults(w io.Writer, results []selfplayResult) error {
+	names := match.agentNames()
+	records := csv.NewWriter(w)
+	if err := records.Write([]string{"game", "white", "black", "result", "termination", "plies", "game_id"}); err != nil {
+		return err
+	}
+	for _, result := range results {
+		if err := records.Write([]string{
+			strconv.Itoa(result.index + 1),
+			names[result.purple],
+			names[1-result.purple],
+			result.game.End.String(),
+			result.game.Termination,
+			strconv.Itoa(result.game.MoveCount),
+			result.game.GameID.String(),
+		}); err != nil {
+			return err
+		}
+	}
+	records.Flush()
+	return records.Error()
+}
+
+// writeDirectory writes games.pgn, results.csv and summary.txt to dir.
+func (match selfplayMatch) writeDirectory(dir string, results []selfplayResult) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	var pgn strings.Builder
+	for _, result := range results {
+		pgn.WriteString(result.pgn)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "games.pgn"), []byte(pgn.String()), 0644); err != nil {
+		return err
+	}
+	for name, write := range map[string]func(io.Writer, []selfplayResult) error{
+		"results.csv": match.writeResults,
+		"summary.txt": match.writeSummary,
+	} {
+		file, err := os.Create(filepath.Join(dir, name))
+		if err != nil {
+			return err
+		}
+		if err := write(file, results); err != nil {
+			file.Close()
+			return err
+		}
+		if err := file.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func selfplayCommand(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("selfplay", flag.ContinueOnError)
+	match := selfplayMatch{}
+	flags.IntVar(&match.games, "games", 1, "number of games")
+	flags.IntVar(&match.workers, "workers", 1, "games played at once")
+	flags.StringVar(&match.agents[0].Type, "white", "alphabeta", "agent type playing white in the first game")
+	flags.StringVar(&match.agents[1].Type, "black", "agent", "agent type playing black in the first game")
+	flags.StringVar(&match.agents[0].Name, "white-name", "", "player name rating the white agent of the first game, its type when empty")
+	flags.StringVar(&match.agents[1].Name, "black-name", "", "player name rating the black agent of the first game, its type when empty")
+	flags.BoolVar(&match.alternate, "alternate", true, "swap colours every game")
+	flags.IntVar(&match.randomPlies, "random-plies", 0, "random plies played from each opening before the agents")
+	flags.Int64Var(&match.seed, "seed", 1, "seed of the random opening plies")
+	fen := flags.String("fen", "", "starting position, the initial position when empty")
+	book := flags.String("book", "", "file of FEN or EPD openings played in turn")
+	dir := flags.String("out", "", "directory for games.pgn, results.csv and summary.txt, PGN to standard output when empty")
+	depth := flags.Int("depth", 0, "search depth of alphabeta and neural agents, the agent default when 0")
+	playouts := flags.Int("playouts", 0, "playouts per move of mcts agents, the agent default when 0")
+	moveTime := flags.Int("movetime", 0, "move time in milliseconds of both agents, the agent default when 0")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 0 {
+		return errors.New("usage: nknight selfplay [-games n] [-workers n] [-white type] [-black type] [-white-name name] [-black-name name] [-book file | -fen fen] [-random-plies n] [-out dir]")
+	}
+	if match.games < 1 || match.workers < 1 || match.randomPlies < 0 || *depth < 0 || *playouts < 0 || *moveTime < 0 {
+		return errors.New("games and workers must be positive and random plies, depth, playouts and movetime not negative")
+	}
+	for _, agent := range match.agents {
+		if !validAgentType(agent.Type) {
+			return fmt.Errorf("unknown agent type %q", agent.Type)
+		}
+	}
+	if match.agents[0].Type == "user" || match.agents[1].Type == "user" {
+		return errors.New("selfplay agents cannot be users")
+	}
+	if match.agents[0].Name != "" && match.agents[0].Name == match.agents[1].Name {
+		return errors.New("white and black names must differ")
+	}
+	if *fen != "" && *book != "" {
+		return errors.New("fen and book are exclusive")
+	}
+	if *fen != "" {
+		match.openings = []string{*fen}
+	}
+	if *book != "" {
+		file, err := os.Open(*book)
+		if err != nil {
+			return err
+		}
+		match.openings, err = readOpenings(file)
+		file.Close()
+		if err != nil {
+			return err
+		}
+		if len(match.openings) == 0 {
+			return fmt.Errorf("no openings in %s", *book)
+		}
+	}
+	for i := range match.agents {
+		match.agents[i].MoveTime = *moveTime
+		if match.agents[i].Type == "mcts" {
+			match.agents[i].Playouts = *playouts
+		} else {
+			match.agents[i].Depth = *depth
+		}
+	}
+	results, err := match.run()
+	if err != nil {
+		return err
+	}
+	if *dir != "" {
+		if err := match.writeDirectory(*dir, results); err != nil {
+			return err
+		}
+	} else {
+		for _, result := range results {
+			if _, err := io.WriteString(out, result.pgn); err != nil {
+				return err
+			}
+		}
+	}
+	return match.writeSummary(out, results)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "gopkg.in/check.v1"
+)
+
+const mateInOneFEN = "6k1/5ppp/8/8/8/8/5PPP/R5K1 w - - 0 1"
+
+func (s *NKnightSuite) TestSelfplayCommand(c *C) {
+	var out bytes.Buffer
+	c.Assert(selfplayCommand([]string{"-fen", mateInOneFEN, "-black", "alphabeta", "-depth", "2", "-games", "2", "-workers", "2"}, &out), IsNil)
+	c.Assert(strings.Count(out.String(), "[Result \"1-0\"]"), Equals, 2)
+	c.Assert(strings.Count(out.String(), "1. Ra8# 1-0"), Equals, 2)
+	c.Assert(out.String(), Matches, `(?s).*
+        Agent  Games  Wins  Draws  Losses  Score
+  alphabeta 1      2     1      0       1    1.0
+  alphabeta 2      2     1      0       1    1.0
+`)
+	out.Reset()
+	c.Assert(selfplayCommand([]string{"-fen", mateInOneFEN, "-depth", "2", "-alternate=false"}, &out), IsNil)
+	c.Assert(out.String(), Matches, `(?s).*\[White "alphabeta"\]\n\[Black "agent"\].*1\. Ra8# 1-0\n\n.*
+ +alphabeta +1 +1 +0 +0 +1.0
+ +agent +1 +0 +0 +1 +0.0
+`)
+	out.Reset()
+	c.Assert(selfplayCommand([]string{"-fen", mateInOneFEN, "-black", "alphabeta", "-depth", "2", "-games", "2", "-white-name", "alphabeta-next", "-black-name", "alphabeta-last"}, &out), IsNil)
+	c.Assert(out.String(), Matches, `(?s).*
+           Agent  Games  Wins  Draws  Losses  Score
+  alphabeta-next      2     1      0       1    1.0
+  alphabeta-last      2     1      0       1    1.0
+`)
+	player, history, err := getRatingHistory("alphabeta-next")
+	c.Assert(err, IsNil)
+	c.Assert([]int{player.Games, player.Wins, player.Losses, len(history)}, DeepEquals, []int{2, 1, 1, 2})
+	c.Assert(history[0].Opponent, Equals, "alphabeta-last")
+	out.Reset()
+	c.Assert(selfplayCommand([]string{"-fen", mateInOneFEN, "-depth", "2", "-alternate=false", "-white-name", `deep "blue"\2`}, &out), IsNil)
+	c.Assert(out.String(), Matches, `(?s).*\[White "deep \\"blue\\"\\\\2"\]\n\[Black "agent"\].*`)
+	c.Assert(selfplayCommand([]string{"-white-name", "v1", "-black-name", "v1"}, &out), ErrorMatches, "white and black names must differ")
+	c.Assert(selfplayCommand([]string{"-white", "alphabeta", "-white-name", "user:alice", "-fen", mateInOneFEN}, &out), ErrorMatches, ".*player names starting with user: are reserved for users")
+	c.Assert(selfplayCommand([]string{"-white", "user"}, &out), ErrorMatches, "selfplay agents cannot be users")
+	c.Assert(selfplayCommand([]string{"-black", "alphabta"}, &out), ErrorMatches, `unknown agent type "alphabta"`)
+	c.Assert(selfplayCommand([]string{"-games", "0"}, &out), ErrorMatches, "games and workers must be positive .*")
+	c.Assert(selfplayCommand([]string{"-workers", "0"}, &out), ErrorMatches, "games and workers must be positive .*")
+	c.Assert(selfplayCommand([]string{"-fen", mateInOneFEN, "-book", "book.epd"}, &out), ErrorMatches, "fen and book are exclusive")
+	c.Assert(selfplayCommand([]string{"extra"}, &out), ErrorMatches, "usage: .*")
+}
+
+func (s *NKnightSuite) TestSelfplayDirectory(c *C) {
+	dir, err := os.MkdirTemp("", "nknight")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+	book := filepath.Join(dir, "book.epd")
+	c.Assert(os.WriteFile(book, []byte("# mate in one for either side\n"+mateInOneFEN+"\nr5k1/5ppp/8/8/8/8/5PPP/6K1 b - - bm Ra1#; id \"back rank\";\n6k1/5ppp/8/8/8/8/5PPP/R5K1 w - - bm Ra8#;\n"), 0644), IsNil)
+	var out bytes.Buffer
+	games := filepath.Join(dir, "games")
+	c.Assert(selfplayCommand([]string{"-book", book, "-white", "alphabeta", "-black", "neural", "-depth", "2", "-games", "3", "-out", games}, &out), IsNil)
+	c.Assert(out.String(), Equals, `      Agent  Games  Wins  Draws  Losses  Score
+  alphabeta      3     3      0       0    3.0
+     neural      3     0      0       3    0.0
+`)
+	summary, err := os.ReadFile(filepath.Join(games, "summary.txt"))
+	c.Assert(err, IsNil)
+	c.Assert(string(summary), Equals, out.String())
+	pgn, err := os.ReadFile(filepath.Join(games, "games.pgn"))
+	c.Assert(err, IsNil)
+	c.Assert(string(pgn), Matches, `(?s)\[Event.*1\. Ra8# 1-0\n\n\[Event.*1\.\.\. Ra1# 0-1\n\n\[Event.*1\. Ra8# 1-0\n\n`)
+	results, err := os.ReadFile(filepath.Join(games, "results.csv"))
+	c.Assert(err, IsNil)
+	c.Assert(string(results), Matches, `game,white,black,result,termination,plies,game_id
+1,alphabeta,neural,1-0,checkmate,1,[0-9a-f-]+
+2,neural,alphabeta,0-1,checkmate,2,[0-9a-f-]+
+3,alphabeta,neural,1-0,checkmate,1,[0-9a-f-]+
+`)
+
+	c.Assert(os.WriteFile(book, []byte("not a fen\n"), 0644), IsNil)
+	c.Assert(selfplayCommand([]string{"-book", book}, &out), ErrorMatches, "opening line 1: .*")
+}
+
+func (s *NKnightSuite) TestSelfplayWorkers(c *C) {
+	var out bytes.Buffer
+	c.Assert(selfplayCommand([]string{"-fen", "k7/8/2K5/8/8/8/8/7R w - - 0 1", "-white", "alphabeta", "-black", "alphabeta", "-depth", "4", "-games", "4", "-workers", "4"}, &out), IsNil)
+	c.Assert(strings.Count(out.String(), "[Result \"1-0\"]"), Equals, 4)
+	c.Assert(strings.Count(out.String(), "1. Kb6 Kb8 2. Rh8# 1-0"), Equals, 4)
+}
+
+func (s *NKnightSuite) TestSelfplayOpening(c *C) {
+	match := selfplayMatch{randomPlies: 4, seed: 7}
+	first, err := match.opening(0)
+	c.Assert(err, IsNil)
+	again, err := match.opening(0)
+	c.Assert(err, IsNil)
+	c.Assert(again, Equals, first)
+	board, _, fullmove, err := parseFEN(first)
+	c.Assert(err, IsNil)
+	c.Assert(board.activePurple(), Equals, true)
+	c.Assert(fullmove, Equals, 3)
+	match.openings = []string{mateInOneFEN, initialFEN}
+	match.randomPlies = 0
+	fen, err := match.opening(3)
+	c.Assert(err, IsNil)
+	c.Assert(fen, Equals, initialFEN)
+}
+
+func (s *NKnightSuite) TestSelfplaySummaryUnfinished(c *C) {
+	match := selfplayMatch{agents: [2]selfplayAgent{{Type: "alphabeta"}, {Type: "mcts"}}}
+	var out bytes.Buffer
+	c.Assert(match.writeSummary(&out, []selfplayResult{
+		{purple: 0, game: &Game{End: resultPurple}},
+		{purple: 1, game: &Game{End: resultDraw}},
+		{purple: 0, game: &Game{End: resultNone}},
+		{purple: 1, game: &Game{End: resultUnknown}},
+	}), IsNil)
+	c.Assert(out.String(), Equals, `      Agent  Games  Wins  Draws  Losses  Score
+  alphabeta      4     1      1       0    1.5
+       mcts      4     0      1       1    0.5
+`)
+}
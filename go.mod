@@ -9,5 +9,6 @@ require (
 	github.com/satori/go.uuid v1.2.0
 	gopkg.in/check.v1 v1.0.0-20201130134442-10cb98267c6c
 	gorm.io/driver/postgres v1.0.8
+	gorm.io/driver/sqlite v1.1.4
 	gorm.io/gorm v1.21.3
 )
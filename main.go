@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"os"
 	"os/signal"
@@ -45,10 +46,16 @@ func Open(addr string) {
 func idle() {
 	idleError("agent idle complete:", agentIdle())
 	idleError("game idle complete:", gameIdle())
+	if err := reloadNetwork(); err != nil {
+		log.WithError(err).Warn("network reload failed")
+	}
 }
 
 // Close close.
 func Close() error {
+	if db == nil {
+		return nil
+	}
 	sqlDB, err := db.DB()
 	if err != nil {
 		return err
@@ -60,11 +67,38 @@ func main() {
 	defer func() {
 		idleError("close server:", Close())
 	}()
-	flag.Parse()
-	go func() {
-		for {
-			idle()
+	cfg, args, err := loadConfig(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.WithError(err).Fatal("failed to load config")
+	}
+	settings = cfg
+	if cfg.Weights != "" {
+		if err := watchNetwork(cfg.Weights); err != nil {
+			log.WithError(err).WithField("weights", cfg.Weights).Fatal("failed to load network")
 		}
-	}()
-	Open(":8080")
+	}
+	name := "serve"
+	if len(args) > 0 {
+		name, args = args[0], args[1:]
+	}
+	if name == "help" {
+		printCommands(os.Stdout)
+		return
+	}
+	command, ok := findCommand(name)
+	if !ok {
+		printCommands(os.Stderr)
+		log.WithField("command", name).Fatal("unknown command")
+	}
+	if command.storage {
+		if err := openStorage(cfg); err != nil {
+			log.WithError(err).WithField("store", cfg.Store).Fatal("failed to open storage")
+		}
+	}
+	if err := command.run(args, os.Stdout); err != nil {
+		log.WithError(err).Fatal(name + " failed")
+	}
 }
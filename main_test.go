@@ -9,7 +9,10 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
 	"path"
+	"regexp"
+	"sort"
 	"strings"
 	"testing"
 	"time"
@@ -48,19 +51,23 @@ var invalidUUIDErr string
 var invalidAgent string
 var invalidGame string
 var invalidGamePlays string
+var invalidGamePGN string
 var unknownUUID = "00600006-8600-4020-8711-600510061050"
 var unknownAgent string
 var unknownGame string
 var unknownGamePlays string
+var unknownGamePGN string
 
 func init() {
 	invalidUUIDErr = strings.Join([]string{"uuid: incorrect UUID format", invalidUUID}, " ")
 	invalidAgent = path.Join("agents", invalidUUID)
 	invalidGame = path.Join("games", invalidUUID)
 	invalidGamePlays = path.Join(invalidGame, "plays")
+	invalidGamePGN = path.Join(invalidGame, "pgn")
 	unknownAgent = path.Join("agents", unknownUUID)
 	unknownGame = path.Join("games", unknownUUID)
 	unknownGamePlays = path.Join(unknownGame, "plays")
+	unknownGamePGN = path.Join(unknownGame, "pgn")
 }
 
 type echoErrorResponse struct {
@@ -76,6 +83,12 @@ type NKnightSuite struct {
 var _ = Suite(&NKnightSuite{})
 
 func (s *NKnightSuite) SetUpSuite(c *C) {
+	cfg := defaultConfig()
+	cfg.Store = "sqlite-memory"
+	if kind, ok := os.LookupEnv("NKNIGHT_STORE"); ok {
+		cfg.Store, cfg.DSN = kind, os.Getenv("NKNIGHT_DSN")
+	}
+	c.Assert(openStorage(cfg), IsNil)
 	s.srv = httptest.NewServer(apiHandler())
 	s.client = s.srv.Client()
 	endpoint, err := url.Parse(s.srv.URL)
@@ -293,7 +306,45 @@ func (s *NKnightSuite) TestFmtBoard(c *C) {
 	c.Assert(value, Equals, "00000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000")
 	value, err = initialBoard.Value()
 	c.Assert(err, IsNil)
-	c.Assert(value, Equals, "0d07030b0503070d0909090909090909000000000000000000000000000000000000000000000000000000000000000008080808080808080c06020a0402060c")
+	c.Assert(value, Equals, "3d27232b3523273d2929292929292929000000000000000000000000000000000000000000000000000000000000000008080808080808081c06020a1402061c")
+}
+
+func (s *NKnightSuite) TestFmtFEN(c *C) {
+	c.Assert(initialBoard.FEN(0, 1), Equals, initialFEN)
+	board, halfmove, fullmove, err := parseFEN(initialFEN)
+	c.Assert(err, IsNil)
+	c.Assert(board, Equals, initialBoard)
+	c.Assert(halfmove, Equals, 0)
+	c.Assert(fullmove, Equals, 1)
+	for _, fen := range []string{
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
+		"rnbqkbnr/ppp1p1pp/8/3pPp2/8/8/PPPP1PPP/RNBQKBNR w KQkq f6 0 3",
+		"r3k2r/8/8/8/8/8/8/R3K2R b Kq - 7 21",
+		"8/8/8/8/8/8/8/4K2k b - - 12 40",
+	} {
+		board, halfmove, fullmove, err := parseFEN(fen)
+		c.Assert(err, IsNil)
+		c.Assert(board.FEN(halfmove, fullmove), Equals, fen)
+	}
+}
+
+func (s *NKnightSuite) TestFmtBadFEN(c *C) {
+	for fen, message := range map[string]string{
+		"":                              "fen is not 6 fields: 0",
+		"8/8/8/8/8/8/8 w - - 0 1":       "fen is not 8 ranks: 7",
+		"8/8/8/8/8/8/8/9 w - - 0 1":     "invalid piece '9' in rank 1",
+		"8/8/8/8/8/8/8/4K2kk w - - 0 1": "rank 1 is longer than 8: 4K2kk",
+		"8/8/8/8/8/8/8/4K2 w - - 0 1":   "rank 1 is not length 8: 4K2",
+		"8/8/8/8/8/8/8/4K2k x - - 0 1":  "invalid active color \"x\"",
+		"8/8/8/8/8/8/8/4K2k w K - 0 1":  "castling availability 'K' without king and rook in place",
+		"8/8/8/8/8/8/8/4K2k w - e3 0 1": "invalid en passant target \"e3\"",
+		"8/8/8/8/8/8/8/4K2k w - e6 0 1": "en passant target \"e6\" without pawn in place",
+		"8/8/8/8/8/8/8/4K2k w - - -1 1": "invalid halfmove clock \"-1\"",
+		"8/8/8/8/8/8/8/4K2k w - - 0 0":  "invalid fullmove number \"0\"",
+	} {
+		_, _, _, err := parseFEN(fen)
+		c.Assert(err, ErrorMatches, regexp.QuoteMeta(message))
+	}
 }
 
 // func (s *NKnightSuite) TestGetGames(c *C) {
@@ -437,6 +488,534 @@ func (s *NKnightSuite) TestFmtBoard(c *C) {
 // 	c.Assert(response.Game.MovesSincePawn, greaterThan, 0)
 // }
 
+func (s *NKnightSuite) TestPassant(c *C) {
+	state, _, _, err := parseFEN("rnbqkbnr/ppp1p1pp/8/3pPp2/8/8/PPPP1PPP/RNBQKBNR w KQkq f6 0 3")
+	c.Assert(err, IsNil)
+	var passant []move
+	for _, m := range state.moveList(true) {
+		if m.depart == position('e', 5) && m.capture {
+			passant = append(passant, m)
+		}
+	}
+	c.Assert(passant, HasLen, 1)
+	c.Assert(passant[0].dest, Equals, position('f', 6))
+	c.Assert(passant[0].String(), Equals, "♙e5xf6")
+	var m move
+	_, err = fmt.Sscan(passant[0].String(), &m)
+	c.Assert(err, IsNil)
+	c.Assert(m, Equals, passant[0])
+	next := state.moveToBoard(m, true).swap()
+	c.Assert(next.FEN(0, 3), Equals, "rnbqkbnr/ppp1p1pp/5P2/3p4/8/8/PPPP1PPP/RNBQKBNR b KQkq - 0 3")
+
+	state, _, _, err = parseFEN("4k3/8/8/8/3p4/8/4P2P/4K3 w - - 0 1")
+	c.Assert(err, IsNil)
+	next = state.moveToBoard(move{piece: '♙', depart: position('e', 2), dest: position('e', 4)}, true).swap()
+	c.Assert(next.FEN(0, 1), Equals, "4k3/8/8/8/3pP3/8/7P/4K3 b - e3 0 1")
+	value, err := next.Value()
+	c.Assert(err, IsNil)
+	var scanned chessState
+	c.Assert(scanned.Scan(value), IsNil)
+	c.Assert(scanned, Equals, next)
+	other := state.moveToBoard(move{piece: '♙', depart: position('h', 2), dest: position('h', 4)}, true).swap()
+	c.Assert(other.FEN(0, 1), Equals, "4k3/8/8/8/3p3P/8/4P3/4K3 b - - 0 1")
+}
+
+func (s *NKnightSuite) TestPassantFEN(c *C) {
+	played := initialBoard.moveToBoard(move{piece: '♙', depart: position('e', 2), dest: position('e', 4)}, true).swap()
+	for _, fen := range []string{
+		"rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1",
+		"rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq - 0 1",
+	} {
+		state, _, _, err := parseFEN(fen)
+		c.Assert(err, IsNil)
+		c.Assert(state, Equals, played)
+		c.Assert(state.zobrist(), Equals, played.zobrist())
+		c.Assert(state.FEN(0, 1), Equals, "rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq - 0 1")
+	}
+	state, _, _, err := parseFEN("4k3/8/8/8/3p4/8/4P2P/4K3 w - - 0 1")
+	c.Assert(err, IsNil)
+	played = state.moveToBoard(move{piece: '♙', depart: position('e', 2), dest: position('e', 4)}, true).swap()
+	parsed, _, _, err := parseFEN("4k3/8/8/8/3pP3/8/7P/4K3 b - e3 0 1")
+	c.Assert(err, IsNil)
+	c.Assert(parsed, Equals, played)
+	c.Assert(parsed.zobrist(), Equals, played.zobrist())
+}
+
+func castlingMoves(c *C, fen string) string {
+	state, _, _, err := parseFEN(fen)
+	c.Assert(err, IsNil)
+	castling := ""
+	for _, m := range state.moveList(state.activePurple()) {
+		if m.castling != 0 {
+			castling = castling + string(m.castling)
+		}
+	}
+	return castling
+}
+
+func playFEN(c *C, fen string, m move) string {
+	state, halfmove, fullmove, err := parseFEN(fen)
+	c.Assert(err, IsNil)
+	return state.moveToBoard(m, state.activePurple()).swap().FEN(halfmove, fullmove)
+}
+
+func (s *NKnightSuite) TestCastling(c *C) {
+	c.Assert(castlingMoves(c, "r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1"), Equals, "kq")
+	c.Assert(castlingMoves(c, "r3k2r/8/8/8/8/8/8/R3K2R b KQkq - 0 1"), Equals, "kq")
+	c.Assert(playFEN(c, "r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1", move{castling: 'k'}), Equals, "r3k2r/8/8/8/8/8/8/R4RK1 b kq - 0 1")
+	c.Assert(playFEN(c, "r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1", move{castling: 'q'}), Equals, "r3k2r/8/8/8/8/8/8/2KR3R b kq - 0 1")
+	c.Assert(playFEN(c, "r3k2r/8/8/8/8/8/8/R3K2R b KQkq - 0 1", move{castling: 'k'}), Equals, "r4rk1/8/8/8/8/8/8/R3K2R w KQ - 0 1")
+	c.Assert(playFEN(c, "r3k2r/8/8/8/8/8/8/R3K2R b KQkq - 0 1", move{castling: 'q'}), Equals, "2kr3r/8/8/8/8/8/8/R3K2R w KQ - 0 1")
+}
+
+func (s *NKnightSuite) TestCastlingIllegal(c *C) {
+	c.Assert(castlingMoves(c, "r3k2r/8/8/8/8/8/8/R3K2R w - - 0 1"), Equals, "")
+	c.Assert(castlingMoves(c, "r3k2r/8/8/8/8/8/8/R3K2R w Kkq - 0 1"), Equals, "k")
+	c.Assert(castlingMoves(c, "4k3/4r3/8/8/8/8/8/R3K2R w KQ - 0 1"), Equals, "")
+	c.Assert(castlingMoves(c, "4k3/5r2/8/8/8/8/8/R3K2R w KQ - 0 1"), Equals, "q")
+	c.Assert(castlingMoves(c, "4k3/3r4/8/8/8/8/8/R3K2R w KQ - 0 1"), Equals, "k")
+	c.Assert(castlingMoves(c, "4k3/6r1/8/8/8/8/8/R3K2R w KQ - 0 1"), Equals, "q")
+	c.Assert(castlingMoves(c, "4k3/2r5/8/8/8/8/8/R3K2R w KQ - 0 1"), Equals, "k")
+	c.Assert(castlingMoves(c, "4k3/1r6/8/8/8/8/8/R3K2R w KQ - 0 1"), Equals, "kq")
+	c.Assert(castlingMoves(c, "4k3/8/8/8/8/8/5p2/R3K2R w KQ - 0 1"), Equals, "")
+	c.Assert(castlingMoves(c, "4k3/8/8/8/8/7n/8/R3K2R w KQ - 0 1"), Equals, "q")
+	c.Assert(castlingMoves(c, "4k3/8/8/8/8/8/8/RN2K1NR w KQ - 0 1"), Equals, "")
+	c.Assert(castlingMoves(c, "4k3/8/8/8/8/8/8/R2BKB1R w KQ - 0 1"), Equals, "")
+	c.Assert(castlingMoves(c, "r3k2r/8/3N4/8/8/8/8/4K3 b kq - 0 1"), Equals, "")
+	c.Assert(castlingMoves(c, "r3k2r/8/8/B7/8/8/8/4K3 b kq - 0 1"), Equals, "k")
+}
+
+func (s *NKnightSuite) TestCastlingRights(c *C) {
+	fen := "r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1"
+	c.Assert(playFEN(c, fen, move{piece: '♖', depart: position('h', 1), dest: position('h', 2)}), Equals, "r3k2r/8/8/8/8/8/7R/R3K3 b Qkq - 0 1")
+	c.Assert(playFEN(c, fen, move{piece: '♖', depart: position('a', 1), dest: position('a', 2)}), Equals, "r3k2r/8/8/8/8/8/R7/4K2R b Kkq - 0 1")
+	c.Assert(playFEN(c, fen, move{piece: '♔', depart: position('e', 1), dest: position('d', 1)}), Equals, "r3k2r/8/8/8/8/8/8/R2K3R b kq - 0 1")
+	fen = "r3k2r/8/8/8/8/8/8/R3K2R b KQkq - 0 1"
+	c.Assert(playFEN(c, fen, move{piece: '♜', depart: position('h', 8), dest: position('h', 1), capture: true}), Equals, "r3k3/8/8/8/8/8/8/R3K2r w Qq - 0 1")
+	c.Assert(castlingMoves(c, "r3k3/8/8/8/8/8/8/R3K2r w Qq - 0 1"), Equals, "")
+}
+
+func (s *NKnightSuite) TestCheck(c *C) {
+	state, _, _, err := parseFEN("4k3/8/8/8/8/8/4r3/4K3 w - - 0 1")
+	c.Assert(err, IsNil)
+	c.Assert(state.inCheck(true), Equals, true)
+	moves := state.moveList(true)
+	sans := make([]string, 0, len(moves))
+	for _, m := range moves {
+		sans = append(sans, state.san(m, moves, true))
+	}
+	sort.Strings(sans)
+	c.Assert(sans, DeepEquals, []string{"Kd1", "Kf1", "Kxe2"})
+	state, _, _, err = parseFEN("4k3/4r3/8/8/8/8/4B3/4K3 w - - 0 1")
+	c.Assert(err, IsNil)
+	c.Assert(state.inCheck(true), Equals, false)
+	for _, m := range state.moveList(true) {
+		c.Assert(pieceValue(m.piece), Equals, king)
+	}
+}
+
+func (s *NKnightSuite) TestOutcome(c *C) {
+	for fen, expected := range map[string]struct {
+		result      gameResult
+		termination string
+	}{
+		initialFEN: {resultNone, ""},
+		"rnb1kbnr/pppp1ppp/8/4p3/6Pq/5P2/PPPPP2P/RNBQKBNR w KQkq - 1 3": {resultGreen, "checkmate"},
+		"6k1/5ppp/8/8/8/8/8/3R2K1 b - - 0 1":                            {resultNone, ""},
+		"3R2k1/5ppp/8/8/8/8/8/6K1 b - - 0 1":                            {resultPurple, "checkmate"},
+		"7k/5Q2/6K1/8/8/8/8/8 b - - 0 1":                                {resultDraw, "stalemate"},
+	} {
+		state, _, _, err := parseFEN(fen)
+		c.Assert(err, IsNil)
+		result, termination := state.outcome()
+		c.Assert(result, Equals, expected.result)
+		c.Assert(termination, Equals, expected.termination)
+	}
+	buffer, err := json.Marshal(resultDraw)
+	c.Assert(err, IsNil)
+	c.Assert(string(buffer), Equals, `"1/2-1/2"`)
+	var result gameResult
+	c.Assert(json.Unmarshal([]byte(`"0-1"`), &result), IsNil)
+	c.Assert(result, Equals, resultGreen)
+	c.Assert(json.Unmarshal([]byte(`"2-0"`), &result), ErrorMatches, `invalid result "2-0"`)
+}
+
+func (s *NKnightSuite) TestPlayCheckmate(c *C) {
+	var game gameResponse
+	s.post201(c, "games", gameRequest{FEN: "rnbqkbnr/pppp1ppp/8/4p3/6P1/5P2/PPPPP2P/RNBQKBNR b KQkq - 0 2"}, &game)
+	agent1 := s.addUser(c, game.Game.GameID)
+	s.addUser(c, game.Game.GameID)
+	state, _, _, err := parseFEN(game.Game.FEN)
+	c.Assert(err, IsNil)
+	moves := state.moveList(false)
+	m, err := state.parseSAN("Qh4", moves)
+	c.Assert(err, IsNil)
+	c.Assert(state.san(m, moves, false), Equals, "Qh4#")
+	board := state.moveToBoard(m, false).swap()
+	var response gameResponse
+	s.put200(c, agent1.Href, &playRequest{Board: &board}, &response)
+	c.Assert(response.Game.End, Equals, resultGreen)
+	c.Assert(response.Game.Termination, Equals, "checkmate")
+	res := s.get(c, path.Join(game.Href, "pgn"))
+	defer res.Body.Close()
+	buffer, err := ioutil.ReadAll(res.Body)
+	c.Assert(err, IsNil)
+	c.Assert(strings.HasSuffix(string(buffer), "\n\n2... Qh4# 0-1\n\n"), Equals, true)
+}
+
+func (s *NKnightSuite) TestInsufficientMaterial(c *C) {
+	for fen, expected := range map[string]bool{
+		"4k3/8/8/8/8/8/8/4K3 w - - 0 1":     true,
+		"4k3/8/8/8/8/8/8/2B1K3 w - - 0 1":   true,
+		"4k3/8/8/8/8/8/8/1N2K3 w - - 0 1":   true,
+		"2b1k3/8/8/8/8/8/8/4KB2 w - - 0 1":  true,
+		"4kb2/8/8/8/8/8/8/4KB2 w - - 0 1":   false,
+		"4k3/8/8/8/8/8/8/1NN1K3 w - - 0 1":  false,
+		"4k3/8/8/8/8/8/4P3/4K3 w - - 0 1":   false,
+		"4k3/8/8/8/8/8/8/R3K3 w - - 0 1":    false,
+		"4k3/8/8/8/8/8/8/1N1BK3 w - - 0 1":  false,
+		"4k3/8/8/8/8/8/8/B1B1K3 w - - 0 1":  true,
+		"3qk3/8/8/8/8/8/8/4K3 w - - 0 1":    false,
+		"4k3/8/8/8/8/8/8/4K1n1 w - - 0 1":   true,
+		"4k3/8/8/8/8/8/3b4/B3K3 w - - 0 1":  true,
+		"4k3/8/8/8/8/8/4b3/B3K3 w - - 0 1":  false,
+		"4k3/8/8/8/8/8/8/4K3 b - - 0 1":     true,
+		"4k3/8/8/8/8/8/8/4K2n b - - 0 1":    true,
+		"4k3/8/8/8/8/8/8/4K2q b - - 0 1":    false,
+		"4k3/8/8/8/8/8/8/2n1K2n b - - 0 1":  false,
+		"4k3/8/8/8/8/8/8/2b1K2b b - - 0 1":  false,
+		"4k3/8/8/8/8/8/8/2b1K1b1 b - - 0 1": true,
+	} {
+		state, _, _, err := parseFEN(fen)
+		c.Assert(err, IsNil)
+		c.Assert(state.insufficientMaterial(), Equals, expected, Commentf(fen))
+	}
+}
+
+func (s *NKnightSuite) TestResetsClock(c *C) {
+	state, _, _, err := parseFEN("4k3/8/8/8/3p4/8/4P3/R3K3 w - - 0 1")
+	c.Assert(err, IsNil)
+	for san, expected := range map[string]bool{"e3": true, "e4": true, "Ra8+": false, "Ra4": false, "Kd1": false} {
+		m, err := state.parseSAN(san, state.moveList(true))
+		c.Assert(err, IsNil)
+		c.Assert(state.resetsClock(state.moveToBoard(m, true).swap()), Equals, expected, Commentf(san))
+	}
+	state, _, _, err = parseFEN("4k3/8/8/8/r2p4/8/4P3/R3K3 w - - 0 1")
+	c.Assert(err, IsNil)
+	m, err := state.parseSAN("Rxa4", state.moveList(true))
+	c.Assert(err, IsNil)
+	c.Assert(state.resetsClock(state.moveToBoard(m, true).swap()), Equals, true)
+}
+
+func (s *NKnightSuite) playSAN(c *C, agent *gameResponse, san string) *gameResponse {
+	var response gameResponse
+	s.put200(c, agent.Href, &playRequest{SAN: san}, &response)
+	return &response
+}
+
+func (s *NKnightSuite) TestPlayThreefoldRepetition(c *C) {
+	var game gameResponse
+	s.post201(c, "games", gameRequest{FEN: "4k3/8/8/8/8/8/8/1N2K1N1 w - - 0 1"}, &game)
+	agent1 := s.addUser(c, game.Game.GameID)
+	agent2 := s.addUser(c, game.Game.GameID)
+	s.put400(c, agent1.Href, &playRequest{Claim: true}, "no draw to claim")
+	for i := 0; i < 2; i++ {
+		s.playSAN(c, agent1, "Nc3")
+		s.playSAN(c, agent2, "Kd8")
+		s.playSAN(c, agent1, "Nb1")
+		response := s.playSAN(c, agent2, "Ke8")
+		c.Assert(response.Game.End, Equals, resultNone)
+		c.Assert(response.Game.MovesSincePawn, Equals, 4*(i+1))
+	}
+	s.put406(c, agent2.Href, &playRequest{Claim: true}, "not your turn")
+	var response gameResponse
+	s.put200(c, agent1.Href, &playRequest{Claim: true}, &response)
+	c.Assert(response.Game.End, Equals, resultDraw)
+	c.Assert(response.Game.Termination, Equals, "threefold repetition")
+	state, _, _, err := parseFEN("4k3/8/8/8/8/8/8/1N2K1N1 w - - 0 1")
+	c.Assert(err, IsNil)
+	board, err := getBoardByBoard(state)
+	c.Assert(err, IsNil)
+	c.Assert(board.ActiveScore == drawScore && board.InactiveScore == drawScore, Equals, false)
+	c.Assert(len(board.Children) > 0, Equals, true)
+}
+
+func (s *NKnightSuite) TestPlayFiftyMoveRule(c *C) {
+	var game gameResponse
+	s.post201(c, "games", gameRequest{FEN: "4k3/8/8/8/8/8/8/1N2K1N1 w - - 98 80"}, &game)
+	agent1 := s.addUser(c, game.Game.GameID)
+	agent2 := s.addUser(c, game.Game.GameID)
+	s.playSAN(c, agent1, "Nc3")
+	s.put400(c, agent2.Href, &playRequest{Claim: true}, "no draw to claim")
+	response := s.playSAN(c, agent2, "Kd8")
+	c.Assert(response.Game.MovesSincePawn, Equals, 100)
+	c.Assert(response.Game.End, Equals, resultNone)
+	s.put200(c, agent1.Href, &playRequest{Claim: true}, response)
+	c.Assert(response.Game.End, Equals, resultDraw)
+	c.Assert(response.Game.Termination, Equals, "fifty-move rule")
+}
+
+func (s *NKnightSuite) TestPlayInsufficientMaterial(c *C) {
+	var game gameResponse
+	s.post201(c, "games", gameRequest{FEN: "4k3/8/8/8/8/8/3p4/4K3 w - - 0 1"}, &game)
+	agent1 := s.addUser(c, game.Game.GameID)
+	s.addUser(c, game.Game.GameID)
+	response := s.playSAN(c, agent1, "Kxd2")
+	c.Assert(response.Game.End, Equals, resultDraw)
+	c.Assert(response.Game.Termination, Equals, "insufficient material")
+	state, _, _, err := parseFEN("4k3/8/8/8/8/8/3K4/8 b - - 0 1")
+	c.Assert(err, IsNil)
+	board, err := getBoardByBoard(state)
+	c.Assert(err, IsNil)
+	c.Assert([]int{board.ActiveScore, board.InactiveScore}, DeepEquals, []int{drawScore, drawScore})
+	c.Assert(response.Game.MovesSincePawn, Equals, 0)
+}
+
+var testPGN = `[Event "Casual"]
+[Site "?"]
+[Date "2021.03.01"]
+[Round "-"]
+[White "A"]
+[Black "B"]
+[Result "1-0"]
+
+1. e4 {best by test} e5 2. Nf3 (2. f4 exf4) Nc6 $1 3.Bb5 a6!? 1-0
+
+[Event "Broken"]
+[Result "*"]
+
+% escaped line
+1. e4 e5 2. Ke3 ; not a legal move
+*
+`
+
+func (s *NKnightSuite) TestParsePGN(c *C) {
+	games, err := parsePGN(strings.NewReader(testPGN))
+	c.Assert(err, IsNil)
+	c.Assert(games, HasLen, 2)
+	c.Assert(games[0].Tags["White"], Equals, "A")
+	c.Assert(games[0].Tags["Date"], Equals, "2021.03.01")
+	c.Assert(games[0].Moves, DeepEquals, []string{"e4", "e5", "Nf3", "Nc6", "Bb5", "a6!?"})
+	c.Assert(games[0].Result, Equals, "1-0")
+	c.Assert(games[1].Tags["Event"], Equals, "Broken")
+	c.Assert(games[1].Moves, DeepEquals, []string{"e4", "e5", "Ke3"})
+	c.Assert(games[1].Result, Equals, "*")
+	_, err = parsePGN(strings.NewReader("1. e4 (e5"))
+	c.Assert(err, ErrorMatches, "unbalanced variation")
+	_, err = parsePGN(strings.NewReader("[Event \"x"))
+	c.Assert(err, ErrorMatches, "unterminated tag: EOF")
+}
+
+func (s *NKnightSuite) TestParseSAN(c *C) {
+	moves := initialBoard.moveList(true)
+	m, err := initialBoard.parseSAN("Nf3", moves)
+	c.Assert(err, IsNil)
+	c.Assert(m.depart, Equals, position('g', 1))
+	c.Assert(m.dest, Equals, position('f', 3))
+	m, err = initialBoard.parseSAN("e4!", moves)
+	c.Assert(err, IsNil)
+	c.Assert(m.depart, Equals, position('e', 2))
+	c.Assert(m.dest, Equals, position('e', 4))
+	_, err = initialBoard.parseSAN("e5", moves)
+	c.Assert(err, ErrorMatches, `illegal san "e5"`)
+	_, err = initialBoard.parseSAN("Zz9", moves)
+	c.Assert(err, ErrorMatches, `invalid san "Zz9"`)
+	state, _, _, err := parseFEN("4k3/8/8/8/8/8/8/2N1K1N1 w - - 0 1")
+	c.Assert(err, IsNil)
+	moves = state.moveList(true)
+	_, err = state.parseSAN("Ne2", moves)
+	c.Assert(err, ErrorMatches, `ambiguous san "Ne2"`)
+	m, err = state.parseSAN("Nge2", moves)
+	c.Assert(err, IsNil)
+	c.Assert(m.depart, Equals, position('g', 1))
+	c.Assert(state.san(m, moves, true), Equals, "Nge2")
+}
+
+func (s *NKnightSuite) TestScanMove(c *C) {
+	for _, text := range []string{"♘g1f3", "♟e7e5", "♙e5xf6", "♙b7a8♕", "♟g2xh1♞"} {
+		var m move
+		_, err := fmt.Sscan(text, &m)
+		c.Assert(err, IsNil)
+		c.Assert(m.String(), Equals, text)
+	}
+	var m move
+	_, err := fmt.Sscan("♘g1f3", &m)
+	c.Assert(err, IsNil)
+	c.Assert(m, Equals, move{piece: '♘', depart: position('g', 1), dest: position('f', 3)})
+	_, err = fmt.Sscan("0-0-0", &m)
+	c.Assert(err, IsNil)
+	c.Assert(m.castling, Equals, byte('q'))
+	for _, text := range []string{"e2e4", "♘g1", "♘g1f9", "♘i1f3", "♘g1xf", "♙b7a8Q"} {
+		_, err := fmt.Sscan(text, &m)
+		c.Assert(err, ErrorMatches, "invalid move format .*")
+	}
+}
+
+func (s *NKnightSuite) TestPlaySAN(c *C) {
+	var game gameResponse
+	s.post201(c, "games", gameRequest{}, &game)
+	agent1 := s.addUser(c, game.Game.GameID)
+	agent2 := s.addUser(c, game.Game.GameID)
+	var plays playsResponse
+	s.get200(c, path.Join(game.Href, "plays"), &plays)
+	c.Assert(plays.SAN, HasLen, 20)
+	c.Assert(plays.SAN, HasLen, len(plays.Moves))
+	sort.Strings(plays.SAN)
+	c.Assert(plays.SAN[:3], DeepEquals, []string{"Na3", "Nc3", "Nf3"})
+	s.put400(c, agent1.Href, &playRequest{SAN: "e5"}, `illegal san "e5"`)
+	s.put400(c, agent1.Href, &playRequest{SAN: "Zz9"}, `invalid san "Zz9"`)
+	s.playSAN(c, agent1, "e4")
+	s.playSAN(c, agent2, "e5")
+	s.playSAN(c, agent1, "Qh5")
+	s.playSAN(c, agent2, "Nc6")
+	s.playSAN(c, agent1, "Bc4")
+	s.playSAN(c, agent2, "Nf6")
+	s.get200(c, path.Join(game.Href, "plays"), &plays)
+	found := false
+	for _, san := range plays.SAN {
+		found = found || san == "Qxf7#"
+	}
+	c.Assert(found, Equals, true)
+	response := s.playSAN(c, agent1, "Qxf7#")
+	c.Assert(response.Game.End, Equals, resultPurple)
+	c.Assert(response.Game.Termination, Equals, "checkmate")
+}
+
+func (s *NKnightSuite) TestUCI(c *C) {
+	state, _, _, err := parseFEN("r3k2r/1P6/8/8/8/8/8/R3K2R b KQkq - 0 1")
+	c.Assert(err, IsNil)
+	moves := state.moveList(false)
+	m, err := parseUCI("e8g8", moves, false)
+	c.Assert(err, IsNil)
+	c.Assert(m.castling, Equals, byte('k'))
+	_, err = parseUCI("e8c8", moves, false)
+	c.Assert(err, ErrorMatches, `illegal uci "e8c8"`)
+	m, err = parseUCI("a8a2", moves, false)
+	c.Assert(err, IsNil)
+	c.Assert(m.uci(false), Equals, "a8a2")
+	_, err = parseUCI("e1g1", moves, false)
+	c.Assert(err, ErrorMatches, `illegal uci "e1g1"`)
+	_, err = parseUCI("O-O", moves, false)
+	c.Assert(err, ErrorMatches, `invalid uci "O-O"`)
+	next := state.moveToBoard(m, false).swap()
+	moves = next.moveList(true)
+	m, err = parseUCI("b7b8n", moves, true)
+	c.Assert(err, IsNil)
+	c.Assert(m.promotion, Equals, '♘')
+	m, err = parseUCI("e1g1", moves, true)
+	c.Assert(err, IsNil)
+	c.Assert(m.castling, Equals, byte('k'))
+	_, err = parseUCI("b7b8", moves, true)
+	c.Assert(err, ErrorMatches, `illegal uci "b7b8"`)
+}
+
+func (s *NKnightSuite) TestPlayUCI(c *C) {
+	var game gameResponse
+	s.post201(c, "games", gameRequest{}, &game)
+	agent1 := s.addUser(c, game.Game.GameID)
+	agent2 := s.addUser(c, game.Game.GameID)
+	var plays playsResponse
+	s.get200(c, path.Join(game.Href, "plays"), &plays)
+	c.Assert(plays.UCI, HasLen, len(plays.Moves))
+	sort.Strings(plays.UCI)
+	c.Assert(plays.UCI[:2], DeepEquals, []string{"a2a3", "a2a4"})
+	s.put400(c, agent1.Href, &playRequest{UCI: "e7e5"}, `illegal uci "e7e5"`)
+	s.put400(c, agent1.Href, &playRequest{UCI: "e2"}, `invalid uci "e2"`)
+	var response gameResponse
+	s.put200(c, agent1.Href, &playRequest{UCI: "e2e4"}, &response)
+	c.Assert(response.Game.FEN, Equals, "rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq - 0 1")
+	s.get200(c, path.Join(game.Href, "plays"), &plays)
+	sort.Strings(plays.UCI)
+	c.Assert(plays.UCI[:2], DeepEquals, []string{"a7a5", "a7a6"})
+	s.put200(c, agent2.Href, &playRequest{UCI: "e7e5"}, &response)
+	c.Assert(response.Game.FEN, Equals, "rnbqkbnr/pppp1ppp/8/4p3/4P3/8/PPPP1PPP/RNBQKBNR w KQkq - 0 2")
+}
+
+func (s *NKnightSuite) TestPostImports(c *C) {
+	res, err := s.client.Post(s.makeURLString(c, "imports"), "application/x-chess-pgn", strings.NewReader(testPGN))
+	c.Assert(err, IsNil)
+	defer res.Body.Close()
+	c.Assert(res.StatusCode, Equals, 201)
+	var response importResponse
+	s.responseJSON(c, res, &response)
+	c.Assert(response.Href, Equals, "/imports")
+	c.Assert(response.Import.Games, Equals, 1)
+	c.Assert(response.Import.Positions, Equals, 7)
+	c.Assert(response.Import.Errors, DeepEquals, []string{`game 2: illegal san "Ke3"`})
+	parent, err := getBoardByBoard(initialBoard)
+	c.Assert(err, IsNil)
+	child, err := getBoardByBoard(initialBoard.moveToBoard(move{piece: '♙', depart: position('e', 2), dest: position('e', 4)}, true).swap())
+	c.Assert(err, IsNil)
+	var count int64
+	c.Assert(db.Table("game_play").Where("board_id", parent.ID).Where("child_id", child.ID).Count(&count).Error, IsNil)
+	c.Assert(count, Equals, int64(1))
+}
+
+func (s *NKnightSuite) TestImportReturns(c *C) {
+	summary, err := importPGN(strings.NewReader("[FEN \"7k/8/8/8/8/8/3K4/R7 w - - 0 1\"]\n\n1. Kc3 Kg8 2. Ra7 1-0\n"))
+	c.Assert(err, IsNil)
+	c.Assert(summary.Positions, Equals, 4)
+	state, _, _, err := parseFEN("7k/8/8/8/8/8/3K4/R7 w - - 0 1")
+	c.Assert(err, IsNil)
+	first, err := getBoardByBoard(state)
+	c.Assert(err, IsNil)
+	activeReturn, inactiveReturn, _ := learnReturns(resultPurple, true, 3)
+	c.Assert([]int{first.ActiveReturn, first.InactiveReturn}, DeepEquals, []int{activeReturn, inactiveReturn})
+	c.Assert(first.Children, HasLen, 1)
+	plays, err := getGamePlays(first.ID)
+	c.Assert(err, IsNil)
+	c.Assert([]int{plays[0].Visits, plays[0].Wins}, DeepEquals, []int{1, 1})
+	state, _, _, err = parseFEN("6k1/R7/8/8/8/2K5/8/8 b - - 3 2")
+	c.Assert(err, IsNil)
+	last, err := getBoardByBoard(state)
+	c.Assert(err, IsNil)
+	c.Assert([]int{last.ActiveReturn, last.InactiveReturn}, DeepEquals, []int{0, 0})
+}
+
+func (s *NKnightSuite) TestPostImportsBadPGN(c *C) {
+	res, err := s.client.Post(s.makeURLString(c, "imports"), "application/x-chess-pgn", strings.NewReader("1. e4 (e5"))
+	c.Assert(err, IsNil)
+	defer res.Body.Close()
+	s.response400(c, res, "unbalanced variation")
+}
+
+func (s *NKnightSuite) TestPostGamesFEN(c *C) {
+	fen := "4k3/8/8/8/8/8/4P3/4K3 b - - 3 17"
+	var response gameResponse
+	s.post201(c, "games", gameRequest{FEN: fen}, &response)
+	c.Assert(response.Game.FEN, Equals, fen)
+	c.Assert(response.Game.ActiveAgentPurple, Equals, false)
+	c.Assert(response.Game.MoveCount, Equals, 33)
+	c.Assert(response.Game.MovesSincePawn, Equals, 3)
+	var state gameResponse
+	s.get200(c, response.Href, &state)
+	c.Assert(state.Game.FEN, Equals, fen)
+}
+
+func (s *NKnightSuite) TestGetGamePGN(c *C) {
+	game := s.generateGame(c)
+	agent1 := s.addUser(c, game.Game.GameID)
+	agent2 := s.addUser(c, game.Game.GameID)
+	board := initialBoard.moveToBoard(move{piece: '♙', depart: position('e', 2), dest: position('e', 4)}, true).swap()
+	var state gameResponse
+	s.put200(c, agent1.Href, &playRequest{Board: &board}, &state)
+	board = board.moveToBoard(move{piece: '♞', depart: position('g', 8), dest: position('f', 6)}, false).swap()
+	s.put200(c, agent2.Href, &playRequest{Board: &board}, &state)
+	res := s.get(c, path.Join(game.Href, "pgn"))
+	defer res.Body.Close()
+	c.Assert(res.StatusCode, Equals, 200)
+	c.Assert(res.Header.Get("Content-Type"), Equals, "application/x-chess-pgn")
+	buffer, err := ioutil.ReadAll(res.Body)
+	c.Assert(err, IsNil)
+	pgn := string(buffer)
+	c.Assert(pgn, Matches, `(?s)\[Event "nknight"\]\n\[Site "nknight"\]\n\[Date "\d{4}\.\d{2}\.\d{2}"\]\n\[Round "-"\]\n\[White "user"\]\n\[Black "user"\]\n\[Result "\*"\]\n.*`)
+	c.Assert(strings.HasSuffix(pgn, "\n\n1. e4 Nf6 *\n\n"), Equals, true)
+}
+
+func (s *NKnightSuite) TestPostGamesBadFEN(c *C) {
+	s.post400(c, "games", gameRequest{FEN: "8/8/8/8/8/8/8 w - - 0 1"}, "fen is not 8 ranks: 7")
+}
+
 func (s *NKnightSuite) TestDeleteBadURL(c *C) {
 	s.delete404(c, "foo")
 }
@@ -505,6 +1084,14 @@ func (s *NKnightSuite) TestGetGamePlaysUnknownID(c *C) {
 	s.get404(c, unknownGamePlays)
 }
 
+func (s *NKnightSuite) TestGetGamePGNInvaidID(c *C) {
+	s.get400(c, invalidGamePGN, invalidUUIDErr)
+}
+
+func (s *NKnightSuite) TestGetGamePGNUnknownID(c *C) {
+	s.get404(c, unknownGamePGN)
+}
+
 func (s *NKnightSuite) TestPostGamePlaysUnknownID(c *C) {
 	s.post405(c, unknownGamePlays, nil)
 }
@@ -521,6 +1108,12 @@ func (s *NKnightSuite) TestPostAgentsInvalidUUIDGame(c *C) {
 	s.post400(c, "agents", map[string]interface{}{"GameID": invalidUUID}, invalidUUIDErr)
 }
 
+func (s *NKnightSuite) TestPostAgentsUnknownType(c *C) {
+	var game gameResponse
+	s.post201(c, "games", gameRequest{}, &game)
+	s.post400(c, "agents", agentRequest{Type: "alphabta", GameID: game.Game.GameID}, `unknown agent type "alphabta"`)
+}
+
 func (s *NKnightSuite) TestPostAgentsUnknownIDGame(c *C) {
 	id, err := uuid.FromString(unknownUUID)
 	c.Assert(err, IsNil)
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/labstack/echo/v4"
+	uuid "github.com/satori/go.uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	glickoScale      = 173.7178
+	glickoRating     = 1500
+	glickoDeviation  = 350
+	glickoVolatility = 0.06
+	// glickoTau constrains how fast volatility changes.
+	glickoTau     = 0.5
+	glickoEpsilon = 0.000001
+	playerNameMax = 64
+)
+
+// Player player, an agent type, agent version or user with a Glicko-2
+// rating.
+type Player struct {
+	gorm.Model
+
+	Name       string `gorm:"<-:create;uniqueIndex;not null"`
+	Rating     float64
+	Deviation  float64
+	Volatility float64
+	Games      int
+	Wins       int
+	Draws      int
+	Losses     int
+}
+
+// Rating rating of a player after a game.
+type Rating struct {
+	gorm.Model
+
+	PlayerID   uint      `gorm:"index"`
+	GameID     uuid.UUID `gorm:"type:varchar;size:20"`
+	Opponent   string
+	Score      float64
+	Rating     float64
+	Deviation  float64
+	Volatility float64
+}
+
+// ratingLock serialises rating updates so games finishing together do not
+// overwrite each other's changes to a player.
+var ratingLock sync.Mutex
+
+// playerName names the player of an agent: users by their name, agents by
+// the name given for their version, else by type and for neural agents the
+// loaded weights. Anonymous users cannot be told apart and get no player.
+func playerName(agentType, name string) (string, error) {
+	if len(name) > playerNameMax || strings.ContainsAny(name, "/?#%") {
+		return "", echo.NewHTTPError(http.StatusBadRequest, "invalid player name")
+	}
+	if agentType != "user" && strings.HasPrefix(name, "user:") {
+		return "", echo.NewHTTPError(http.StatusBadRequest, "player names starting with user: are reserved for users")
+	}
+	switch {
+	case agentType == "user" && name != "":
+		return "user:" + name, nil
+	case agentType == "user":
+		return "", nil
+	case name != "":
+		return name, nil
+	case agentType == "neural":
+		return "neural@" + networkVersion(), nil
+	}
+	return agentType, nil
+}
+
+type glickoResult struct {
+	rating    float64
+	deviation float64
+	score     float64
+}
+
+func glickoG(phi float64) float64 {
+	return 1 / math.Sqrt(1+3*phi*phi/(math.Pi*math.Pi))
+}
+
+// glicko2 rates a player after one rating period with the results.
+func glicko2(rating, deviation, volatility float64, results []glickoResult) (float64, float64, float64) {
+	mu := (rating - glickoRating) / glickoScale
+	phi := deviation / glickoScale
+	if len(results) == 0 {
+		phi = math.Sqrt(phi*phi + volatility*volatility)
+		return rating, math.Min(phi*glickoScale, glickoDeviation), volatility
+	}
+	v, improvement := 0.0, 0.0
+	for _, result := range results {
+		g := glickoG(result.deviation / glickoScale)
+		e := 1 / (1 + math.Exp(-g*(mu-(result.rating-glickoRating)/glickoScale)))
+		v = v + g*g*e*(1-e)
+		improvement = improvement + g*(result.score-e)
+	}
+	v = 1 / v
+	delta := v * improvement
+
+	a := math.Log(volatility * volatility)
+	f := func(x float64) float64 {
+		ex := math.Exp(x)
+		d := phi*phi + v + ex
+		return ex*(delta*delta-phi*phi-v-ex)/(2*d*d) - (x-a)/(glickoTau*glickoTau)
+	}
+	A := a
+	var B float64
+	if delta*delta > phi*phi+v {
+		B = math.Log(delta*delta - phi*phi - v)
+	} else {
+		k := 1.0
+		for f(a-k*glickoTau) < 0 {
+			k = k + 1
+		}
+		B = a - k*glickoTau
+	}
+	fA, fB := f(A), f(B)
+	for math.Abs(B-A) > glickoEpsilon {
+		C := A + (A-B)*fA/(fB-fA)
+		fC := f(C)
+		if fC*fB <= 0 {
+			A, fA = B, fB
+		} else {
+			fA = fA / 2
+		}
+		B, fB = C, fC
+	}
+	volatility = math.Exp(A / 2)
+
+	phiStar := math.Sqrt(phi*phi + volatility*volatility)
+	phi = 1 / math.Sqrt(1/(phiStar*phiStar)+1/v)
+	mu = mu + phi*phi*improvement
+	return mu*glickoScale + glickoRating, phi * glickoScale, volatility
+}
+
+// rate updates the ratings of both players of a finished game and records
+// them in their history. Games with an anonymous user are not rated, nor are
+// games a player plays against itself, such as idle games between two agents
+// of one type or selfplay without names, as they say nothing of its strength
+// against others.
+func (game Game) rate() error {
+	names := [2]string{game.ActiveAgentName, game.InactiveAgentName}
+	if names[0] == "" || names[1] == "" || names[0] == names[1] {
+		return nil
+	}
+	ratingLock.Lock()
+	defer ratingLock.Unlock()
+	return store.ratePlayers(names, func(players [2]Player) ([2]Player, [2]Rating) {
+		var ratings [2]Rating
+		purple := [2]bool{game.ActiveAgentPurple, !game.ActiveAgentPurple}
+		updated := players
+		for i, player := range players {
+			opponent := players[1-i]
+			score := 0.5
+			switch game.End {
+			case winner(purple[i]):
+				score = 1
+				updated[i].Wins = player.Wins + 1
+			case winner(!purple[i]):
+				score = 0
+				updated[i].Losses = player.Losses + 1
+			default:
+				updated[i].Draws = player.Draws + 1
+			}
+			updated[i].Games = player.Games + 1
+			updated[i].Rating, updated[i].Deviation, updated[i].Volatility = glicko2(player.Rating, player.Deviation, player.Volatility, []glickoResult{{opponent.Rating, opponent.Deviation, score}})
+			ratings[i] = Rating{PlayerID: player.ID, GameID: game.GameID, Opponent: opponent.Name, Score: score, Rating: updated[i].Rating, Deviation: updated[i].Deviation, Volatility: updated[i].Volatility}
+		}
+		return updated, ratings
+	})
+}
+
+// finish learns from and rates a game that just ended.
+func (game Game) finish() error {
+	if err := game.learn(); err != nil {
+		return err
+	}
+	return game.rate()
+}
+
+func getPlayers() ([]Player, error) {
+	return store.getPlayers()
+}
+
+func getRatingHistory(name string) (Player, []Rating, error) {
+	return store.getRatingHistory(name)
+}
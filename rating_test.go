@@ -0,0 +1,102 @@
+package main
+
+import (
+	"math"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *NKnightSuite) TestGlicko2(c *C) {
+	rating, deviation, volatility := glicko2(1500, 200, 0.06, []glickoResult{
+		{1400, 30, 1},
+		{1550, 100, 0},
+		{1700, 300, 0},
+	})
+	c.Assert(math.Abs(rating-1464.06) < 0.01, Equals, true)
+	c.Assert(math.Abs(deviation-151.52) < 0.01, Equals, true)
+	c.Assert(math.Abs(volatility-0.05999) < 0.00001, Equals, true)
+	rating, deviation, volatility = glicko2(1500, 200, 0.06, nil)
+	c.Assert(rating, Equals, 1500.0)
+	c.Assert(deviation > 200, Equals, true)
+	c.Assert(volatility, Equals, 0.06)
+	_, deviation, _ = glicko2(1500, 350, 0.06, nil)
+	c.Assert(deviation, Equals, 350.0)
+}
+
+func (s *NKnightSuite) TestPlayerName(c *C) {
+	for _, t := range []struct {
+		agentType string
+		name      string
+		player    string
+	}{
+		{"user", "", ""},
+		{"user", "alice", "user:alice"},
+		{"alphabeta", "", "alphabeta"},
+		{"alphabeta", "alphabeta-v2", "alphabeta-v2"},
+		{"neural", "", "neural@" + networkVersion()},
+	} {
+		player, err := playerName(t.agentType, t.name)
+		c.Assert(err, IsNil)
+		c.Assert(player, Equals, t.player)
+	}
+	_, err := playerName("user", "a/b")
+	c.Assert(err, ErrorMatches, ".*invalid player name")
+	_, err = playerName("alphabeta", "user:alice")
+	c.Assert(err, ErrorMatches, ".*player names starting with user: are reserved for users")
+}
+
+func (s *NKnightSuite) TestRatings(c *C) {
+	var game gameResponse
+	s.post201(c, "games", gameRequest{}, &game)
+	s.post400(c, "agents", agentRequest{Type: "user", Name: "a?b", GameID: game.Game.GameID}, "invalid player name")
+	s.post400(c, "agents", agentRequest{Type: "alphabeta", Name: "user:alice", GameID: game.Game.GameID}, "player names starting with user: are reserved for users")
+	var alice, bob gameResponse
+	s.post201(c, "agents", agentRequest{Type: "user", Name: "alice", GameID: game.Game.GameID}, &alice)
+	s.post201(c, "agents", agentRequest{Type: "user", Name: "bob", GameID: game.Game.GameID}, &bob)
+	c.Assert(bob.Game.ActiveAgentName, Equals, "user:alice")
+	c.Assert(bob.Game.InactiveAgentName, Equals, "user:bob")
+	for i, san := range []string{"f3", "e5", "g4", "Qh4#"} {
+		agent := &alice
+		if i%2 == 1 {
+			agent = &bob
+		}
+		s.playSAN(c, agent, san)
+	}
+
+	var ratings ratingsResponse
+	s.get200(c, "ratings", &ratings)
+	c.Assert(ratings.Href, Equals, "/ratings")
+	players := map[string]Player{}
+	for i, player := range ratings.Players {
+		players[player.Name] = player
+		if i > 0 {
+			c.Assert(player.Rating <= ratings.Players[i-1].Rating, Equals, true)
+		}
+	}
+	c.Assert(players["user:bob"].Rating > glickoRating, Equals, true)
+	c.Assert(players["user:alice"].Rating < glickoRating, Equals, true)
+	c.Assert(players["user:bob"].Deviation < glickoDeviation, Equals, true)
+	c.Assert([]int{players["user:bob"].Games, players["user:bob"].Wins, players["user:bob"].Draws, players["user:bob"].Losses}, DeepEquals, []int{1, 1, 0, 0})
+	c.Assert([]int{players["user:alice"].Games, players["user:alice"].Wins, players["user:alice"].Draws, players["user:alice"].Losses}, DeepEquals, []int{1, 0, 0, 1})
+
+	var history ratingResponse
+	s.get200(c, "ratings/user:bob", &history)
+	c.Assert(history.Href, Equals, "/ratings/user:bob")
+	c.Assert(history.Player.Name, Equals, "user:bob")
+	c.Assert(history.History, HasLen, 1)
+	c.Assert(history.History[0].Opponent, Equals, "user:alice")
+	c.Assert(history.History[0].Score, Equals, 1.0)
+	c.Assert(history.History[0].GameID, Equals, game.Game.GameID)
+	c.Assert(history.History[0].Rating, Equals, history.Player.Rating)
+	s.get404(c, "ratings/nobody")
+}
+
+func (s *NKnightSuite) TestRateSamePlayer(c *C) {
+	game := Game{ActiveAgentName: "agent", InactiveAgentName: "agent", End: resultDraw}
+	c.Assert(game.rate(), IsNil)
+	game = Game{ActiveAgentName: "", InactiveAgentName: "user:carol", End: resultDraw}
+	c.Assert(game.rate(), IsNil)
+	var count int64
+	c.Assert(db.Model(&Player{}).Where("name IN ?", []string{"agent", "user:carol"}).Count(&count).Error, IsNil)
+	c.Assert(count, Equals, int64(0))
+}
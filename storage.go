@@ -0,0 +1,320 @@
+package main
+
+import (
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// storage storage for boards, games, plays, ratings and the queries of the
+// idle loop.
+type storage interface {
+	makeBoard(state chessState) (Board, error)
+	getBoard(id uint) (Board, error)
+	getBoardByBoard(state chessState) (Board, error)
+	saveBoard(board *Board, childIDs []uint) error
+	scoreBoard(board *Board) error
+	addReturns(boardID uint, activeReturn, inactiveReturn int) error
+	linkBoards(boardID, childID uint) error
+	hasPlay(boardID, childID uint) (bool, error)
+	getGamePlays(boardID uint) ([]GamePlay, error)
+	addPlay(boardID, childID uint, column string) error
+	createGame(game *Game) error
+	saveGame(game *Game) error
+	getGame(id uuid.UUID) (*Game, error)
+	getGameUnscoped(id uuid.UUID) (*Game, error)
+	getAgent(id uuid.UUID) (*Game, error)
+	addPosition(position *Position) error
+	getPositions(gameID uuid.UUID) ([]Position, error)
+	countRepetitions(gameID uuid.UUID, boardID uint, sincePly int) (int64, error)
+	finishedPositions() ([]finishedPosition, error)
+	ratePlayers(names [2]string, rate func(players [2]Player) ([2]Player, [2]Rating)) error
+	getPlayers() ([]Player, error)
+	getRatingHistory(name string) (Player, []Rating, error)
+	openGames() ([]Game, error)
+	countOpenGames() (int64, error)
+	idleAgentGames(before time.Time) ([]Game, error)
+	countAgentGames() (int64, error)
+	deleteFinishedGames() error
+	finishedGames() ([]Game, error)
+}
+
+var store storage
+
+// finishedPosition a board played in a finished game and its result.
+type finishedPosition struct {
+	Board  chessState
+	Result gameResult
+}
+
+// gormStore storage on a gorm database, used for Postgres, SQLite files and
+// in-memory SQLite.
+type gormStore struct {
+	db *gorm.DB
+}
+
+func (s gormStore) makeBoard(state chessState) (Board, error) {
+	var board Board
+	score := state.evaluate().score()
+	if err := s.db.Where("hash = ?", int64(state.zobrist())).Attrs(Board{ActiveScore: score, InactiveScore: -score}).FirstOrCreate(&board, Board{Board: state}).Error; err != nil {
+		// A concurrent game may have added the board since the lookup.
+		if s.db.Where("hash = ?", int64(state.zobrist())).Where(Board{Board: state}).First(&board).Error != nil {
+			return Board{}, err
+		}
+	}
+	return board, nil
+}
+
+func (s gormStore) getBoard(id uint) (Board, error) {
+	var board Board
+	if err := s.db.Preload(clause.Associations).First(&board, id).Error; err != nil {
+		return Board{}, err
+	}
+	return board, nil
+}
+
+func (s gormStore) getBoardByBoard(state chessState) (Board, error) {
+	var board Board
+	if err := s.db.Preload(clause.Associations).Where("hash = ?", int64(state.zobrist())).Where(Board{Board: state}).First(&board).Error; err != nil {
+		return Board{}, err
+	}
+	return board, nil
+}
+
+// saveBoard saves the scored board, dropping the edges to boards that are no
+// longer among childIDs and keeping the statistics of those that remain.
+func (s gormStore) saveBoard(board *Board, childIDs []uint) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("board_id = ? AND child_id NOT IN ?", board.ID, childIDs).Delete(&GamePlay{}).Error; err != nil {
+			return err
+		}
+		return tx.Save(board).Error
+	})
+}
+
+// scoreBoard saves the scores of a finished position, leaving its edges and
+// their statistics, which other games share, alone.
+func (s gormStore) scoreBoard(board *Board) error {
+	return s.db.Model(&Board{}).Where("id = ?", board.ID).Updates(map[string]interface{}{
+		"active_check_mate": board.ActiveCheckMate,
+		"active_score":      board.ActiveScore,
+		"inactive_score":    board.InactiveScore,
+	}).Error
+}
+
+// addReturns adds returns to the board and its scores, keeping them apart so
+// lookahead adds them back when it rescores the board from its children.
+func (s gormStore) addReturns(boardID uint, activeReturn, inactiveReturn int) error {
+	return s.db.Model(&Board{}).Where("id = ?", boardID).Updates(map[string]interface{}{
+		"active_return":   gorm.Expr("active_return + ?", activeReturn),
+		"active_score":    gorm.Expr("active_score + ?", activeReturn),
+		"inactive_return": gorm.Expr("inactive_return + ?", inactiveReturn),
+		"inactive_score":  gorm.Expr("inactive_score + ?", inactiveReturn),
+	}).Error
+}
+
+func (s gormStore) linkBoards(boardID, childID uint) error {
+	return s.db.Exec("INSERT INTO game_play (board_id, child_id) VALUES (?, ?) ON CONFLICT DO NOTHING", boardID, childID).Error
+}
+
+func (s gormStore) hasPlay(boardID, childID uint) (bool, error) {
+	var count int64
+	if err := s.db.Model(&GamePlay{}).Where("board_id = ? AND child_id = ?", boardID, childID).Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count == 1, nil
+}
+
+func (s gormStore) getGamePlays(boardID uint) ([]GamePlay, error) {
+	var plays []GamePlay
+	if err := s.db.Where("board_id = ?", boardID).Order("child_id").Find(&plays).Error; err != nil {
+		return nil, err
+	}
+	return plays, nil
+}
+
+// addPlay counts a visit and one of wins, draws or losses on the edge,
+// adding the edge first if it is missing.
+func (s gormStore) addPlay(boardID, childID uint, column string) error {
+	if err := s.linkBoards(boardID, childID); err != nil {
+		return err
+	}
+	return s.db.Model(&GamePlay{}).Where("board_id = ? AND child_id = ?", boardID, childID).Updates(map[string]interface{}{
+		"visits": gorm.Expr("visits + 1"),
+		column:   gorm.Expr(column + " + 1"),
+	}).Error
+}
+
+func (s gormStore) createGame(game *Game) error {
+	return s.db.Create(game).Error
+}
+
+func (s gormStore) saveGame(game *Game) error {
+	return s.db.Save(game).Error
+}
+
+func (s gormStore) getGame(id uuid.UUID) (*Game, error) {
+	var game Game
+	if err := s.db.Preload(clause.Associations).First(&game, Game{GameID: id}).Error; err != nil {
+		return nil, err
+	}
+	return &game, nil
+}
+
+// getGameUnscoped finds the game even after the idle loop deleted it.
+func (s gormStore) getGameUnscoped(id uuid.UUID) (*Game, error) {
+	var game Game
+	if err := s.db.Unscoped().Preload(clause.Associations).First(&game, Game{GameID: id}).Error; err != nil {
+		return nil, err
+	}
+	return &game, nil
+}
+
+func (s gormStore) getAgent(id uuid.UUID) (*Game, error) {
+	var game Game
+	if err := s.db.Preload(clause.Associations).Where(Game{ActiveAgent: id}).Or(Game{InactiveAgent: id}).First(&game).Error; err != nil {
+		return nil, err
+	}
+	return &game, nil
+}
+
+func (s gormStore) addPosition(position *Position) error {
+	return s.db.Create(position).Error
+}
+
+// getPositions positions of the game in the order they were played,
+// including those of deleted games.
+func (s gormStore) getPositions(gameID uuid.UUID) ([]Position, error) {
+	var positions []Position
+	if err := s.db.Unscoped().Preload(clause.Associations).Where(Position{GameID: gameID}).Order("ply").Find(&positions).Error; err != nil {
+		return nil, err
+	}
+	return positions, nil
+}
+
+// countRepetitions counts the times the game reached the board since ply.
+func (s gormStore) countRepetitions(gameID uuid.UUID, boardID uint, sincePly int) (int64, error) {
+	var count int64
+	if err := s.db.Model(&Position{}).Where(Position{GameID: gameID, BoardID: boardID}).Where("ply >= ?", sincePly).Count(&count).Error; err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// finishedPositions every position of a finished game, including games the
+// idle loop has since deleted.
+func (s gormStore) finishedPositions() ([]finishedPosition, error) {
+	var positions []finishedPosition
+	if err := s.db.Table("positions").Select("boards.board AS board, games.result AS result").Joins("JOIN boards ON boards.id = positions.board_id").Joins("JOIN games ON games.game_id = positions.game_id").Where("games.result <> ?", resultNone).Scan(&positions).Error; err != nil {
+		return nil, err
+	}
+	return positions, nil
+}
+
+// openGames games waiting for a second agent.
+func (s gormStore) openGames() ([]Game, error) {
+	var games []Game
+	if err := s.db.Where(Game{InactiveAgent: placeHolder}).Find(&games).Error; err != nil {
+		return nil, err
+	}
+	return games, nil
+}
+
+func (s gormStore) countOpenGames() (int64, error) {
+	var count int64
+	if err := s.db.Model(&Game{}).Where(Game{InactiveAgent: placeHolder}).Count(&count).Error; err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// idleAgentGames running games with an agent to move not updated since
+// before.
+func (s gormStore) idleAgentGames(before time.Time) ([]Game, error) {
+	var games []Game
+	if err := s.db.Where("updated_at < ?", before).Not(Game{ActiveAgentType: "user"}).Not(s.db.Where(Game{InactiveAgent: placeHolder}).Or("result <> ?", resultNone)).Find(&games).Error; err != nil {
+		return nil, err
+	}
+	return games, nil
+}
+
+// countAgentGames counts running games between two agents.
+func (s gormStore) countAgentGames() (int64, error) {
+	var count int64
+	if err := s.db.Model(&Game{}).Not(s.db.Where(Game{ActiveAgentType: "user"}).Or(Game{InactiveAgentType: "user"})).Not(s.db.Where(Game{InactiveAgent: placeHolder}).Or("result <> ?", resultNone)).Count(&count).Error; err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// deleteFinishedGames deletes finished games between two agents.
+func (s gormStore) deleteFinishedGames() error {
+	return s.db.Where("result <> ?", resultNone).Not(Game{ActiveAgentType: "user"}).Not(Game{InactiveAgentType: "user"}).Delete(&Game{}).Error
+}
+
+// finishedGames finished games, including those the idle loop deleted, in
+// the order they were created.
+func (s gormStore) finishedGames() ([]Game, error) {
+	var games []Game
+	if err := s.db.Unscoped().Where("result <> ?", resultNone).Order("created_at").Find(&games).Error; err != nil {
+		return nil, err
+	}
+	return games, nil
+}
+
+func getPlayer(tx *gorm.DB, name string) (Player, error) {
+	var player Player
+	if err := tx.Where(Player{Name: name}).Attrs(Player{Rating: glickoRating, Deviation: glickoDeviation, Volatility: glickoVolatility}).FirstOrCreate(&player).Error; err != nil {
+		return Player{}, err
+	}
+	return player, nil
+}
+
+// ratePlayers finds or adds the named players and saves the players and
+// history entries rate returns for them in one transaction.
+func (s gormStore) ratePlayers(names [2]string, rate func(players [2]Player) ([2]Player, [2]Rating)) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var players [2]Player
+		for i, name := range names {
+			player, err := getPlayer(tx, name)
+			if err != nil {
+				return err
+			}
+			players[i] = player
+		}
+		updated, ratings := rate(players)
+		for i := range ratings {
+			if err := tx.Create(&ratings[i]).Error; err != nil {
+				return err
+			}
+		}
+		for i := range updated {
+			if err := tx.Save(&updated[i]).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s gormStore) getPlayers() ([]Player, error) {
+	var players []Player
+	if err := s.db.Order("rating DESC").Find(&players).Error; err != nil {
+		return nil, err
+	}
+	return players, nil
+}
+
+func (s gormStore) getRatingHistory(name string) (Player, []Rating, error) {
+	var player Player
+	if err := s.db.Where(Player{Name: name}).First(&player).Error; err != nil {
+		return Player{}, nil, err
+	}
+	var history []Rating
+	if err := s.db.Where(Rating{PlayerID: player.ID}).Order("id").Find(&history).Error; err != nil {
+		return Player{}, nil, err
+	}
+	return player, history, nil
+}
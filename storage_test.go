@@ -0,0 +1,152 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+
+	uuid "github.com/satori/go.uuid"
+	. "gopkg.in/check.v1"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func (s *NKnightSuite) TestOpenStorage(c *C) {
+	cfg := defaultConfig()
+	cfg.Store = "mongo"
+	c.Assert(openStorage(cfg), ErrorMatches, `unknown store "mongo"`)
+
+	previousDB, previousStore := db, store
+	defer func() {
+		db, store = previousDB, previousStore
+	}()
+	dir, err := os.MkdirTemp("", "nknight")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "nknight.db")
+	for _, kind := range []string{"sqlite-memory", "sqlite"} {
+		cfg.Store, cfg.DSN = kind, path
+		c.Assert(openStorage(cfg), IsNil)
+		board, err := makeBoard(initialBoard)
+		c.Assert(err, IsNil)
+		found, err := getBoardByBoard(initialBoard)
+		c.Assert(err, IsNil)
+		c.Assert(found.ID, Equals, board.ID)
+		game, err := makeGame("")
+		c.Assert(err, IsNil)
+		count, err := store.countOpenGames()
+		c.Assert(err, IsNil)
+		c.Assert(count, Equals, int64(1))
+		found2, err := getGame(game.GameID)
+		c.Assert(err, IsNil)
+		c.Assert(found2.BoardID, Equals, board.ID)
+		c.Assert(Close(), IsNil)
+	}
+	_, err = os.Stat(path)
+	c.Assert(err, IsNil)
+}
+
+func (s *NKnightSuite) TestOpenStorageLegacyBoards(c *C) {
+	previousDB, previousStore := db, store
+	defer func() {
+		db, store = previousDB, previousStore
+	}()
+	dir, err := os.MkdirTemp("", "nknight")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+	cfg := defaultConfig()
+	cfg.Store, cfg.DSN = "sqlite", filepath.Join(dir, "nknight.db")
+	c.Assert(openStorage(cfg), IsNil)
+	var legacy chessState
+	for sq, piece := range initialBoard {
+		legacy[sq] = piece & 0x0F
+	}
+	c.Assert(legacy.legacyEncoding(), Equals, true)
+	c.Assert(initialBoard.legacyEncoding(), Equals, false)
+	c.Assert(db.Create(&Board{Board: legacy}).Error, IsNil)
+	_, err = makeGame("")
+	c.Assert(err, IsNil)
+	c.Assert(Close(), IsNil)
+
+	c.Assert(openStorage(cfg), IsNil)
+	defer Close()
+	c.Assert(migrations, DeepEquals, []string{"reset boards and games stored in the legacy board encoding"})
+	var count int64
+	c.Assert(db.Model(&Board{}).Count(&count).Error, IsNil)
+	c.Assert(count, Equals, int64(0))
+	c.Assert(db.Model(&Game{}).Count(&count).Error, IsNil)
+	c.Assert(count, Equals, int64(0))
+	board, err := makeBoard(initialBoard)
+	c.Assert(err, IsNil)
+	c.Assert(Close(), IsNil)
+
+	c.Assert(openStorage(cfg), IsNil)
+	found, err := getBoardByBoard(initialBoard)
+	c.Assert(err, IsNil)
+	c.Assert(found.ID, Equals, board.ID)
+}
+
+// legacyGame game row with the boolean end column.
+type legacyGame struct {
+	gorm.Model
+
+	ActiveAgentType   string
+	BoardID           uint
+	Board             Board
+	End               bool
+	GameID            uuid.UUID `gorm:"type:varchar;size:20;uniqueIndex"`
+	InactiveAgentType string
+}
+
+func (legacyGame) TableName() string {
+	return "games"
+}
+
+func (s *NKnightSuite) TestOpenStorageLegacyGames(c *C) {
+	previousDB, previousStore := db, store
+	defer func() {
+		db, store = previousDB, previousStore
+	}()
+	dir, err := os.MkdirTemp("", "nknight")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+	cfg := defaultConfig()
+	cfg.Store, cfg.DSN = "sqlite", filepath.Join(dir, "nknight.db")
+	legacy, err := gorm.Open(sqlite.Open(cfg.DSN), &gorm.Config{})
+	c.Assert(err, IsNil)
+	c.Assert(legacy.AutoMigrate(&Board{}, &legacyGame{}), IsNil)
+	board := Board{Board: initialBoard}
+	c.Assert(legacy.Create(&board).Error, IsNil)
+	ended, running := uuid.NewV4(), uuid.NewV4()
+	for _, game := range []legacyGame{
+		{ActiveAgentType: "agent", BoardID: board.ID, End: true, GameID: ended, InactiveAgentType: "agent"},
+		{ActiveAgentType: "agent", BoardID: board.ID, GameID: running, InactiveAgentType: "agent"},
+	} {
+		c.Assert(legacy.Create(&game).Error, IsNil)
+	}
+	sqlDB, err := legacy.DB()
+	c.Assert(err, IsNil)
+	c.Assert(sqlDB.Close(), IsNil)
+
+	c.Assert(openStorage(cfg), IsNil)
+	defer Close()
+	c.Assert(migrations[0], Equals, "replaced games.end with games.result")
+	c.Assert(db.Migrator().HasColumn(&Game{}, "end"), Equals, false)
+	game, err := getGame(ended)
+	c.Assert(err, IsNil)
+	c.Assert(game.End, Equals, resultUnknown)
+	c.Assert(game.End.String(), Equals, "*")
+	game, err = getGame(running)
+	c.Assert(err, IsNil)
+	c.Assert(game.End, Equals, resultNone)
+	games, err := store.finishedGames()
+	c.Assert(err, IsNil)
+	c.Assert(games, HasLen, 1)
+	c.Assert(games[0].GameID, Equals, ended)
+	c.Assert(store.deleteFinishedGames(), IsNil)
+	_, err = getGame(ended)
+	c.Assert(err, ErrorMatches, "record not found")
+	_, err = makeGame("")
+	c.Assert(err, IsNil)
+	c.Assert(Close(), IsNil)
+	c.Assert(openStorage(cfg), IsNil)
+}